@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AgentInfo 子智能体的描述，用于发现接口和规划提示词
+type AgentInfo struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// defaultSubAgents LLM Agent 编排默认注册的子智能体
+func defaultSubAgents() []SubAgent {
+	return []SubAgent{
+		&ScriptGeneratorAgent{},
+		&ImageGeneratorAgent{},
+		&VoiceGeneratorAgent{},
+		&VideoRenderAgent{},
+		&AnalysisAgent{},
+		&QualityCheckAgent{},
+		&OptimizationAgent{},
+	}
+}
+
+// newDefaultToolRegistry Tool-based 编排默认注册的工具
+func newDefaultToolRegistry() *ToolRegistry {
+	registry := NewToolRegistry()
+
+	// 注册所有可用工具
+	registry.RegisterTool(&ContentAnalysisTool{})
+	registry.RegisterTool(&ScriptGenerationTool{})
+	registry.RegisterTool(&ImageGenerationTool{})
+	registry.RegisterTool(&VoiceGenerationTool{})
+	registry.RegisterTool(&QualityCheckTool{})
+	registry.RegisterTool(&VideoRenderTool{})
+
+	return registry
+}
+
+var (
+	catalogOnce   sync.Once
+	catalogTools  *ToolRegistry
+	catalogAgents []AgentInfo
+)
+
+func loadCatalog() {
+	catalogOnce.Do(func() {
+		catalogTools = newDefaultToolRegistry()
+		catalogAgents = agentInfos(defaultSubAgents())
+	})
+}
+
+// AvailableTools 返回编排器使用的工具声明及其版本，与发送给LLM的 tools 参数完全一致
+func AvailableTools() ([]map[string]interface{}, string) {
+	loadCatalog()
+	return catalogTools.GetToolsSchema(), catalogTools.SchemaVersion()
+}
+
+// AvailableAgents 返回编排器注册的子智能体描述及其版本
+func AvailableAgents() ([]AgentInfo, string) {
+	loadCatalog()
+	return catalogAgents, schemaVersion(catalogAgents)
+}
+
+func agentInfos(agents []SubAgent) []AgentInfo {
+	infos := make([]AgentInfo, 0, len(agents))
+	for _, agent := range agents {
+		infos = append(infos, AgentInfo{
+			Name:         agent.GetName(),
+			Description:  agent.GetDescription(),
+			Capabilities: agent.GetCapabilities(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// describeAgents 生成规划提示词中的智能体列表
+func describeAgents(agents []AgentInfo) string {
+	lines := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		line := fmt.Sprintf("- %s: %s", agent.Name, agent.Description)
+		if len(agent.Capabilities) > 0 {
+			line += fmt.Sprintf(" (capabilities: %s)", strings.Join(agent.Capabilities, ", "))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// schemaVersion 对描述的JSON计算短哈希，描述有任何变化时版本随之改变
+func schemaVersion(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
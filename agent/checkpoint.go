@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"video-agent-go/model"
+)
+
+// Checkpointer 保存各阶段已完成的产物，任务失败后重试时据此跳过已完成的部分
+type Checkpointer interface {
+	SaveScript(script *model.ScriptOutput)
+	SaveShotImage(shot int, path string)
+	SaveShotVoice(shot int, path string)
+	SaveShotClip(shot int, path string)
+}
+
+// noopCheckpointer 未设置 Checkpointer 时使用，不保存任何内容
+type noopCheckpointer struct{}
+
+func (noopCheckpointer) SaveScript(*model.ScriptOutput) {}
+func (noopCheckpointer) SaveShotImage(int, string)      {}
+func (noopCheckpointer) SaveShotVoice(int, string)      {}
+func (noopCheckpointer) SaveShotClip(int, string)       {}
+
+func checkpointerOrNoop(cp Checkpointer) Checkpointer {
+	if cp == nil {
+		return noopCheckpointer{}
+	}
+	return cp
+}
+
+// TaskWorkRoot 所有任务工作目录所在的目录
+var TaskWorkRoot = filepath.Join("temp", "tasks")
+
+// TaskWorkDir 任务的工作目录，渲染出的单镜头片段保存在这里供重试复用。
+// 任务完成或取消后删除，失败的任务保留一段时间等待重试
+func TaskWorkDir(taskID string) string {
+	return filepath.Join(TaskWorkRoot, taskID)
+}
+
+// resumeResources 把恢复的脚本中已有的素材转换为工具和智能体使用的资源句柄
+func resumeResources(script *model.ScriptOutput) map[string]string {
+	resources := make(map[string]string)
+	for i, shot := range script.Shots {
+		if shot.ClipPath != "" {
+			resources[imageHandle(i)] = shot.ClipPath
+		}
+		if shot.VoicePath != "" {
+			resources[voiceHandle(i)] = shot.VoicePath
+		}
+	}
+	return resources
+}
+
+// imageHandle 镜头图像在 Resources 中的句柄
+func imageHandle(shot int) string {
+	return fmt.Sprintf("image_%d", shot)
+}
+
+// voiceHandle 镜头配音在 Resources 中的句柄
+func voiceHandle(shot int) string {
+	return fmt.Sprintf("voice_%d", shot)
+}
+
+// renderOptionsFor 有检查点时把片段保存在任务工作目录并记录下来，否则使用一次性的临时目录
+func renderOptionsFor(taskID string, cp Checkpointer) RenderOptions {
+	if _, ok := cp.(noopCheckpointer); ok || cp == nil {
+		return RenderOptions{}
+	}
+	return RenderOptions{
+		WorkDir: TaskWorkDir(taskID),
+		OnClip:  cp.SaveShotClip,
+	}
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"video-agent-go/config"
+	"video-agent-go/netguard"
+)
+
+var (
+	// validateMediaURL 检查用户提供的媒体地址，测试中替换以访问本地服务
+	validateMediaURL = netguard.ValidateURL
+	// mediaDownloader 下载用户媒体的客户端，只连接公网地址
+	mediaDownloader = &http.Client{Transport: netguard.NewTransport()}
+)
+
+// downloadMedia 把用户提供的远程文件下载到 dir，文件名保留原扩展名。
+// 只访问公网地址，整个下载受 MediaDeadline 限制，超过 MaxUploadSize 的文件视为失败
+func downloadMedia(ctx context.Context, rawURL, dir, prefix string) (string, error) {
+	if err := validateMediaURL(rawURL); err != nil {
+		return "", fmt.Errorf("media URL %w", err)
+	}
+	if deadline := config.AppConfig.API.MediaDeadline; deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := mediaDownloader.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("media URL returned %s", resp.Status)
+	}
+	maxSize := config.AppConfig.Storage.MaxUploadSize
+	if resp.ContentLength > maxSize {
+		return "", fmt.Errorf("media is %d bytes, exceeding the %d byte limit", resp.ContentLength, maxSize)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(strings.SplitN(rawURL, "?", 2)[0])
+	path := filepath.Join(dir, fmt.Sprintf("%s_%d%s", prefix, time.Now().UnixNano(), ext))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	// 多读一个字节用来判断是否超限，服务端没有给出或谎报 Content-Length 时也能拦住
+	written, err := io.Copy(file, io.LimitReader(resp.Body, maxSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > maxSize {
+		err = fmt.Errorf("media exceeds the %d byte limit", maxSize)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
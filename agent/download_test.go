@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"video-agent-go/config"
+)
+
+func TestDownloadMediaRefusesPrivateAddresses(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	prev := config.AppConfig
+	config.AppConfig = config.Default()
+	t.Cleanup(func() { config.AppConfig = prev })
+
+	_, err := downloadMedia(context.Background(), srv.URL+"/video.mp4", t.TempDir(), "source")
+	if err == nil || !strings.Contains(err.Error(), "non-public") {
+		t.Errorf("got %v, want the loopback address refused", err)
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Error("download reached a loopback address")
+	}
+}
+
+func TestDownloadMediaSizeLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Streamed without Content-Length so only the copy limit can stop it
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("x", 2048)))
+	}))
+	defer srv.Close()
+
+	prevConfig, prevValidate, prevClient := config.AppConfig, validateMediaURL, mediaDownloader
+	t.Cleanup(func() { config.AppConfig, validateMediaURL, mediaDownloader = prevConfig, prevValidate, prevClient })
+	config.AppConfig = config.Default()
+	validateMediaURL = func(string) error { return nil }
+	mediaDownloader = srv.Client()
+
+	dir := t.TempDir()
+	config.AppConfig.Storage.MaxUploadSize = 1024
+	if _, err := downloadMedia(context.Background(), srv.URL+"/big.mp4", dir, "source"); err == nil {
+		t.Error("downloaded a file over the size limit")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left %d partial files behind", len(entries))
+	}
+
+	config.AppConfig.Storage.MaxUploadSize = 4096
+	path, err := downloadMedia(context.Background(), srv.URL+"/small.mp4?sig=1", dir, "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 2048 || !strings.HasSuffix(path, ".mp4") {
+		t.Errorf("got %s (%v), want the full 2048 byte .mp4", path, err)
+	}
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"encoding/json"
+	"time"
+	"video-agent-go/model"
+)
+
+// ExecutionRecorder 持久化编排过程中的每一次智能体执行和工具调用，构成任务的执行轨迹
+type ExecutionRecorder interface {
+	RecordExecution(record model.ExecutionRecord)
+}
+
+// noopRecorder 未设置 ExecutionRecorder 时使用，不记录任何内容
+type noopRecorder struct{}
+
+func (noopRecorder) RecordExecution(model.ExecutionRecord) {}
+
+func recorderOrNoop(r ExecutionRecorder) ExecutionRecorder {
+	if r == nil {
+		return noopRecorder{}
+	}
+	return r
+}
+
+// stepRecord 把智能体执行步骤转换为执行记录
+func stepRecord(taskID string, step ExecutionStep, startedAt time.Time) model.ExecutionRecord {
+	record := model.ExecutionRecord{
+		TaskID:     taskID,
+		Kind:       model.ExecutionAgentStep,
+		StepID:     step.StepID,
+		Name:       step.AgentName,
+		Action:     step.Action,
+		Parameters: step.Parameters,
+		Success:    step.Success,
+		Error:      step.ErrorMsg,
+		StartedAt:  startedAt,
+		DurationMs: step.Duration,
+	}
+	if step.Result != nil {
+		record.Result = step.Result
+	}
+	return record
+}
+
+// toolCallRecord 把工具调用转换为执行记录，参数是合法JSON时按原样保存
+func toolCallRecord(taskID string, call CompletedToolCall, err error, startedAt time.Time) model.ExecutionRecord {
+	record := model.ExecutionRecord{
+		TaskID:     taskID,
+		Kind:       model.ExecutionToolCall,
+		StepID:     call.Call.ID,
+		Name:       call.Call.Function.Name,
+		StartedAt:  startedAt,
+		DurationMs: call.Duration,
+	}
+
+	if args := call.Call.Function.Arguments; args != "" {
+		if json.Valid([]byte(args)) {
+			record.Parameters = json.RawMessage(args)
+		} else {
+			record.Parameters = args
+		}
+	}
+
+	switch {
+	case err != nil:
+		record.Error = err.Error()
+	case call.Result == nil:
+		record.Error = "tool returned no result"
+	default:
+		record.Result = call.Result
+		record.Success = call.Result.Success
+		record.Error = call.Result.Error
+	}
+	return record
+}
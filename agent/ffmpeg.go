@@ -0,0 +1,9 @@
+package agent
+
+import "strings"
+
+// lastLine 返回 ffmpeg 输出的最后一行，通常就是错误原因
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return lines[len(lines)-1]
+}
@@ -1,15 +1,17 @@
 package agent
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"image"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"time"
 	"video-agent-go/config"
+	"video-agent-go/model"
 	"video-agent-go/storage"
 )
 
@@ -28,35 +30,31 @@ type ImageData struct {
 	URL string `json:"url"`
 }
 
-func GenerateImage(prompt string) (string, error) {
-	reqBody := ImageRequest{
-		Model:  "dall-e-3",
-		Prompt: prompt,
-		Size:   "1024x1024",
-		N:      1,
-	}
+// ImageOptions 图像生成的可选参数
+type ImageOptions struct {
+	Size string // 1024x1024, 1792x1024 或 1024x1792
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
-	}
+func GenerateImage(ctx context.Context, prompt string) (string, error) {
+	return GenerateImageWithOptions(ctx, prompt, ImageOptions{})
+}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/images/generations", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
+// GenerateImageWithOptions 按指定参数生成图像并保存到本地
+func GenerateImageWithOptions(ctx context.Context, prompt string, opts ImageOptions) (string, error) {
+	size := opts.Size
+	if size == "" {
+		size = "1024x1024"
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.AppConfig.API.OpenAIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	reqBody := ImageRequest{
+		Model:  "dall-e-3",
+		Prompt: prompt,
+		Size:   size,
+		N:      1,
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	client := newMediaClient()
+	body, err := client.PostJSON(ctx, apiURL("/images/generations"), reqBody)
 	if err != nil {
 		return "", err
 	}
@@ -72,7 +70,7 @@ func GenerateImage(prompt string) (string, error) {
 
 	// Download and save image
 	imageURL := imageResp.Data[0].URL
-	imagePath, err := downloadAndSaveImage(imageURL)
+	imagePath, err := downloadAndSaveImage(ctx, client, imageURL)
 	if err != nil {
 		return "", err
 	}
@@ -80,12 +78,11 @@ func GenerateImage(prompt string) (string, error) {
 	return imagePath, nil
 }
 
-func downloadAndSaveImage(url string) (string, error) {
-	resp, err := http.Get(url)
+func downloadAndSaveImage(ctx context.Context, client *ProviderClient, url string) (string, error) {
+	data, err := client.Get(ctx, url)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
 	// Create filename with timestamp
 	filename := fmt.Sprintf("image_%d.png", time.Now().UnixNano())
@@ -97,14 +94,7 @@ func downloadAndSaveImage(url string) (string, error) {
 	}
 
 	// Save file locally
-	file, err := os.Create(localPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
+	if err := os.WriteFile(localPath, data, 0644); err != nil {
 		return "", err
 	}
 
@@ -120,10 +110,8 @@ func downloadAndSaveImage(url string) (string, error) {
 	return localPath, nil
 }
 
-func ConvertImageToVideo(imagePath string, duration int) (string, error) {
-	// This is a placeholder for actual video conversion logic
-	// In a real implementation, you would use ffmpeg or similar tools
-
+// ConvertImageToVideo 把静态图像渲染成带镜头运动的视频片段，保存到 uploads/videos
+func ConvertImageToVideo(ctx context.Context, imagePath string, duration int, motion model.Motion) (string, error) {
 	outputPath := fmt.Sprintf("uploads/videos/video_%d.mp4", time.Now().UnixNano())
 
 	// Ensure directory exists
@@ -131,9 +119,136 @@ func ConvertImageToVideo(imagePath string, duration int) (string, error) {
 		return "", err
 	}
 
-	// Placeholder: copy image to video location (for demo purposes)
-	// In reality, you would use ffmpeg to create a video from static image
-	// Example command: ffmpeg -loop 1 -i image.png -c:v libx264 -t 5 -pix_fmt yuv420p output.mp4
-
+	if err := renderMotionClip(ctx, imagePath, "", float64(duration), motion, outputPath); err != nil {
+		return "", err
+	}
 	return outputPath, nil
 }
+
+const (
+	// motionFPS 镜头运动片段的帧率
+	motionFPS = 25
+	// zoomSupersample zoompan 只能按整数像素移动，先放大再缩放可以消除画面抖动
+	zoomSupersample = 4
+	// defaultMotionZoom 只平移不缩放时使用的缩放倍数，留出移动空间
+	defaultMotionZoom = 1.15
+)
+
+// renderMotionClip 用 zoompan 滤镜把图像渲染为 duration 秒的片段，audioPath 不为空时作为音轨
+func renderMotionClip(ctx context.Context, imagePath, audioPath string, duration float64, motion model.Motion, outputPath string) error {
+	width, height := clipSize(imagePath)
+	frames := int(math.Round(duration * motionFPS))
+	if frames < 1 {
+		frames = 1
+	}
+
+	filter := fmt.Sprintf("scale=%d:%d,%s,setsar=1,format=yuv420p",
+		width*zoomSupersample, height*zoomSupersample, zoompanFilter(motion, frames, width, height))
+
+	args := []string{"-i", imagePath}
+	if audioPath != "" {
+		// 配音之后补静音到片段结束，片段时长严格等于 duration
+		args = append(args, "-i", audioPath, "-af", "apad", "-c:a", "aac")
+	}
+	args = append(args,
+		"-vf", filter,
+		"-c:v", "libx264",
+		"-t", fmt.Sprintf("%.3f", duration),
+		"-y", outputPath)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputPath) // a killed ffmpeg leaves a partial clip
+		return fmt.Errorf("ffmpeg error: %v: %s", err, lastLine(output))
+	}
+	return nil
+}
+
+// zoompanFilter 生成 zoompan 滤镜。进度 P 从 0 线性增长到 1，经过缓动曲线后
+// 插值得到每一帧的缩放倍数和可视窗口位置，同样的参数总是得到同样的运动
+func zoompanFilter(motion model.Motion, frames, width, height int) string {
+	zoomStart, zoomEnd := motionZooms(motion)
+
+	progress := "0"
+	if frames > 1 {
+		progress = fmt.Sprintf("on/%d", frames-1)
+	}
+	eased := easingExpr(motion.Easing, "("+progress+")")
+
+	zoom := fmt.Sprintf("%g+(%g)*%s", zoomStart, zoomEnd-zoomStart, eased)
+	x, y := "(iw-iw/zoom)/2", "(ih-ih/zoom)/2"
+	switch motion.Pan {
+	case model.PanRight:
+		x = "(iw-iw/zoom)*" + eased
+	case model.PanLeft:
+		x = "(iw-iw/zoom)*(1-" + eased + ")"
+	case model.PanDown:
+		y = "(ih-ih/zoom)*" + eased
+	case model.PanUp:
+		y = "(ih-ih/zoom)*(1-" + eased + ")"
+	}
+
+	return fmt.Sprintf("zoompan=z='%s':x='%s':y='%s':d=%d:s=%dx%d:fps=%d",
+		zoom, x, y, frames, width, height, motionFPS)
+}
+
+// motionZooms 返回起止缩放倍数。未设置时为 1；平移时至少放大到 defaultMotionZoom，否则没有移动空间
+func motionZooms(motion model.Motion) (float64, float64) {
+	zoomStart, zoomEnd := motion.ZoomStart, motion.ZoomEnd
+	if zoomStart < 1 {
+		zoomStart = 1
+	}
+	if zoomEnd < 1 {
+		zoomEnd = 1
+	}
+	if motion.Pan != "" && motion.Pan != model.PanNone {
+		zoomStart = math.Max(zoomStart, defaultMotionZoom)
+		zoomEnd = math.Max(zoomEnd, defaultMotionZoom)
+	}
+	return math.Min(zoomStart, model.MaxMotionZoom), math.Min(zoomEnd, model.MaxMotionZoom)
+}
+
+// easingExpr 把进度表达式 p 套上缓动曲线
+func easingExpr(easing, p string) string {
+	switch easing {
+	case model.EasingIn:
+		return fmt.Sprintf("(%s*%s)", p, p)
+	case model.EasingOut:
+		return fmt.Sprintf("(1-(1-%s)*(1-%s))", p, p)
+	case model.EasingInOut:
+		return fmt.Sprintf("if(lt(%s,0.5),2*%s*%s,1-2*(1-%s)*(1-%s))", p, p, p, p, p)
+	default:
+		return p
+	}
+}
+
+// defaultMotions 脚本没有指定镜头运动时按镜头序号轮流使用，避免画面静止
+var defaultMotions = []model.Motion{
+	{Pan: model.PanNone, ZoomStart: 1.0, ZoomEnd: 1.15, Easing: model.EasingInOut},
+	{Pan: model.PanRight, ZoomStart: 1.15, ZoomEnd: 1.15, Easing: model.EasingInOut},
+	{Pan: model.PanNone, ZoomStart: 1.15, ZoomEnd: 1.0, Easing: model.EasingInOut},
+	{Pan: model.PanLeft, ZoomStart: 1.15, ZoomEnd: 1.15, Easing: model.EasingInOut},
+}
+
+// shotMotion 返回镜头的运动参数，未指定时按序号选择默认运动
+func shotMotion(shot model.Shot, index int) model.Motion {
+	if shot.Motion != nil {
+		return *shot.Motion
+	}
+	return defaultMotions[index%len(defaultMotions)]
+}
+
+// clipSize 片段分辨率与图像一致（取偶数），无法读取时使用默认画幅
+func clipSize(imagePath string) (int, int) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return frameWidth, frameHeight
+	}
+	defer file.Close()
+
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil || cfg.Width < 2 || cfg.Height < 2 {
+		return frameWidth, frameHeight
+	}
+	return cfg.Width &^ 1, cfg.Height &^ 1
+}
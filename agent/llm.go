@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"video-agent-go/config"
+)
+
+// LLMStage 调用LLM的业务阶段，不同阶段可以配置不同的模型
+type LLMStage string
+
+const (
+	StageScript           LLMStage = "script"
+	StagePlanning         LLMStage = "planning"
+	StageToolOrchestrator LLMStage = "tool_orchestration"
+)
+
+// LLMProvider 大模型提供方接口，屏蔽具体的HTTP实现
+type LLMProvider interface {
+	// Chat 普通对话，返回助手消息的文本内容
+	Chat(ctx context.Context, stage LLMStage, messages []Message) (string, error)
+	// ChatJSON 要求模型按JSON输出，schema为nil时使用 json_object 模式
+	ChatJSON(ctx context.Context, stage LLMStage, messages []Message, schema *JSONSchema) (string, error)
+	// ChatWithTools 支持工具调用的对话，返回完整的助手消息
+	ChatWithTools(ctx context.Context, stage LLMStage, messages []ChatMessage, tools []map[string]interface{}) (*LLMResponse, error)
+}
+
+type OpenAIRequest struct {
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OpenAIResponse struct {
+	Choices []Choice `json:"choices"`
+}
+
+type Choice struct {
+	Message Message `json:"message"`
+}
+
+// OpenAIProvider OpenAI兼容接口的实现，可指向自建或本地的兼容服务
+type OpenAIProvider struct {
+	BaseURL string
+	APIKey  string
+	Models  map[LLMStage]string
+	client  *ProviderClient
+}
+
+// NewOpenAIProvider 根据API配置创建提供方
+func NewOpenAIProvider(cfg config.APIConfig) *OpenAIProvider {
+	return &OpenAIProvider{
+		BaseURL: strings.TrimRight(cfg.OpenAIBaseURL, "/"),
+		APIKey:  cfg.OpenAIKey,
+		Models: map[LLMStage]string{
+			StageScript:           cfg.ScriptModel,
+			StagePlanning:         cfg.PlanningModel,
+			StageToolOrchestrator: cfg.ToolModel,
+		},
+		client: NewProviderClient(cfg, cfg.LLMTimeout, cfg.LLMDeadline),
+	}
+}
+
+// Model 返回某个阶段使用的模型
+func (p *OpenAIProvider) Model(stage LLMStage) string {
+	if model := p.Models[stage]; model != "" {
+		return model
+	}
+	return "gpt-4"
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, stage LLMStage, messages []Message) (string, error) {
+	return p.chat(ctx, OpenAIRequest{
+		Model:    p.Model(stage),
+		Messages: messages,
+	})
+}
+
+// ChatJSON 依次尝试 json_schema、json_object 和不带 response_format 的请求，
+// 不支持结构化输出的模型会以 invalid_request 拒绝前两种，此时退回下一种，由调用方校验输出
+func (p *OpenAIProvider) ChatJSON(ctx context.Context, stage LLMStage, messages []Message, schema *JSONSchema) (string, error) {
+	formats := []*ResponseFormat{{Type: "json_object"}}
+	if schema != nil {
+		formats = append([]*ResponseFormat{{Type: "json_schema", JSONSchema: schema}}, formats...)
+	}
+
+	for _, format := range formats {
+		content, err := p.chat(ctx, OpenAIRequest{
+			Model:          p.Model(stage),
+			Messages:       messages,
+			ResponseFormat: format,
+		})
+		if err == nil || !IsProviderError(err, ErrKindInvalidRequest) {
+			return content, err
+		}
+		log.Printf("Model %s rejected response_format %s, falling back: %v", p.Model(stage), format.Type, err)
+	}
+
+	// 结构化输出都被拒绝，最后发送不带 response_format 的请求
+	return p.chat(ctx, OpenAIRequest{
+		Model:    p.Model(stage),
+		Messages: messages,
+	})
+}
+
+func (p *OpenAIProvider) chat(ctx context.Context, reqBody OpenAIRequest) (string, error) {
+	var openAIResp OpenAIResponse
+	if err := p.postChatCompletion(ctx, reqBody, &openAIResp); err != nil {
+		return "", err
+	}
+
+	if len(openAIResp.Choices) == 0 {
+		return "", fmt.Errorf("no response from OpenAI")
+	}
+
+	return openAIResp.Choices[0].Message.Content, nil
+}
+
+func (p *OpenAIProvider) ChatWithTools(ctx context.Context, stage LLMStage, messages []ChatMessage, tools []map[string]interface{}) (*LLMResponse, error) {
+	reqBody := map[string]interface{}{
+		"model":       p.Model(stage),
+		"messages":    messages,
+		"tools":       tools,
+		"tool_choice": "auto", // 让LLM自动决定是否调用工具
+	}
+
+	var openAIResp struct {
+		Choices []struct {
+			Message LLMResponse `json:"message"`
+		} `json:"choices"`
+	}
+	if err := p.postChatCompletion(ctx, reqBody, &openAIResp); err != nil {
+		return nil, err
+	}
+
+	if len(openAIResp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
+
+	return &openAIResp.Choices[0].Message, nil
+}
+
+// postChatCompletion 发送 /chat/completions 请求并解析响应
+func (p *OpenAIProvider) postChatCompletion(ctx context.Context, reqBody interface{}, out interface{}) error {
+	body, err := p.client.PostJSON(ctx, p.BaseURL+"/chat/completions", reqBody)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid chat completion response: %v", err)
+	}
+	return nil
+}
+
+var (
+	llmProvider LLMProvider
+	llmMutex    sync.Mutex
+)
+
+// GetLLMProvider 返回全局的LLM提供方，首次调用时根据配置创建
+func GetLLMProvider() LLMProvider {
+	llmMutex.Lock()
+	defer llmMutex.Unlock()
+
+	if llmProvider == nil {
+		llmProvider = NewOpenAIProvider(config.AppConfig.API)
+	}
+	return llmProvider
+}
+
+// SetLLMProvider 替换全局的LLM提供方，传入nil时下次调用会按当前配置重新创建
+func SetLLMProvider(provider LLMProvider) {
+	llmMutex.Lock()
+	defer llmMutex.Unlock()
+
+	llmProvider = provider
+}
+
+// apiURL 拼接OpenAI兼容服务的接口地址
+func apiURL(path string) string {
+	return strings.TrimRight(config.AppConfig.API.OpenAIBaseURL, "/") + path
+}
+
+// newMediaClient 图像、语音等媒体接口使用的客户端
+func newMediaClient() *ProviderClient {
+	return NewProviderClient(config.AppConfig.API, config.AppConfig.API.MediaTimeout, config.AppConfig.API.MediaDeadline)
+}
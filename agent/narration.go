@@ -1,11 +1,8 @@
 package agent
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"time"
@@ -14,41 +11,39 @@ import (
 )
 
 type TTSRequest struct {
-	Model string `json:"model"`
-	Input string `json:"input"`
-	Voice string `json:"voice"`
+	Model string  `json:"model"`
+	Input string  `json:"input"`
+	Voice string  `json:"voice"`
+	Speed float64 `json:"speed,omitempty"`
 }
 
-func GenerateVoiceover(text string) (string, error) {
-	reqBody := TTSRequest{
-		Model: "tts-1",
-		Input: text,
-		Voice: "alloy",
-	}
+// VoiceOptions 语音合成的可选参数
+type VoiceOptions struct {
+	Voice string  // alloy, echo, fable, onyx, nova, shimmer
+	Speed float64 // 0.25 - 4.0，0 表示使用默认语速
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
-	}
+func GenerateVoiceover(ctx context.Context, text string) (string, error) {
+	return GenerateVoiceoverWithOptions(ctx, text, VoiceOptions{})
+}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/audio/speech", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
+// GenerateVoiceoverWithOptions 按指定音色和语速合成语音并保存到本地
+func GenerateVoiceoverWithOptions(ctx context.Context, text string, opts VoiceOptions) (string, error) {
+	voice := opts.Voice
+	if voice == "" {
+		voice = "alloy"
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.AppConfig.API.OpenAIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	reqBody := TTSRequest{
+		Model: "tts-1",
+		Input: text,
+		Voice: voice,
+		Speed: opts.Speed,
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("TTS API error: %s", string(body))
+	audio, err := newMediaClient().PostJSON(ctx, apiURL("/audio/speech"), reqBody)
+	if err != nil {
+		return "", fmt.Errorf("TTS API error: %w", err)
 	}
 
 	// Save audio file
@@ -61,14 +56,7 @@ func GenerateVoiceover(text string) (string, error) {
 	}
 
 	// Save file locally
-	file, err := os.Create(localPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
+	if err := os.WriteFile(localPath, audio, 0644); err != nil {
 		return "", err
 	}
 
@@ -5,6 +5,8 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"video-agent-go/model"
 )
 
 type TaskStatus int
@@ -14,6 +16,7 @@ const (
 	TaskProcessing
 	TaskCompleted
 	TaskFailed
+	TaskCancelled
 )
 
 func (ts TaskStatus) String() string {
@@ -26,6 +29,8 @@ func (ts TaskStatus) String() string {
 		return "completed"
 	case TaskFailed:
 		return "failed"
+	case TaskCancelled:
+		return "cancelled"
 	default:
 		return "unknown"
 	}
@@ -40,13 +45,39 @@ type TaskObserver struct {
 	UpdatedAt time.Time
 }
 
+const (
+	// maxEventHistory 每个任务保留用于回放的最近事件数
+	maxEventHistory = 500
+	// subscriberBuffer 订阅者通道的缓冲区大小，消费跟不上时订阅会被关闭
+	subscriberBuffer = 64
+)
+
+// EventSink 接收本进程发布的每一条事件，例如持久化到数据库
+type EventSink func(event model.TaskEvent)
+
+// Subscription 一个任务的事件订阅，Events 关闭表示订阅已结束
+type Subscription struct {
+	TaskID string
+	Events <-chan model.TaskEvent
+
+	events chan model.TaskEvent
+	lastID int64
+}
+
+// ObserverManager 记录任务的当前状态，同时作为任务事件的发布/订阅中心
 type ObserverManager struct {
-	observers map[string]*TaskObserver
-	mutex     sync.RWMutex
+	observers   map[string]*TaskObserver
+	history     map[string][]model.TaskEvent
+	subscribers map[string]map[*Subscription]struct{}
+	sinks       []EventSink
+	nextID      int64
+	mutex       sync.RWMutex
 }
 
 var observerManager = &ObserverManager{
-	observers: make(map[string]*TaskObserver),
+	observers:   make(map[string]*TaskObserver),
+	history:     make(map[string][]model.TaskEvent),
+	subscribers: make(map[string]map[*Subscription]struct{}),
 }
 
 func GetObserverManager() *ObserverManager {
@@ -71,8 +102,6 @@ func (om *ObserverManager) RegisterTask(taskID string) {
 
 func (om *ObserverManager) UpdateTask(taskID string, status TaskStatus, progress int, message string) {
 	om.mutex.Lock()
-	defer om.mutex.Unlock()
-
 	if observer, exists := om.observers[taskID]; exists {
 		observer.Status = status
 		observer.Progress = progress
@@ -81,6 +110,15 @@ func (om *ObserverManager) UpdateTask(taskID string, status TaskStatus, progress
 
 		log.Printf("Task updated: %s - %s (%d%%): %s", taskID, status, progress, message)
 	}
+	om.mutex.Unlock()
+
+	om.Publish(model.TaskEvent{
+		TaskID:   taskID,
+		Type:     model.EventStatus,
+		Status:   status.String(),
+		Progress: progress,
+		Message:  message,
+	})
 }
 
 func (om *ObserverManager) GetTask(taskID string) (*TaskObserver, bool) {
@@ -96,6 +134,7 @@ func (om *ObserverManager) RemoveTask(taskID string) {
 	defer om.mutex.Unlock()
 
 	delete(om.observers, taskID)
+	delete(om.history, taskID)
 	log.Printf("Task removed: %s", taskID)
 }
 
@@ -112,6 +151,120 @@ func (om *ObserverManager) ListTasks() map[string]*TaskObserver {
 	return tasks
 }
 
+// AddSink 注册一个事件接收者，只接收本进程通过 Publish 发布的事件
+func (om *ObserverManager) AddSink(sink EventSink) {
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+
+	om.sinks = append(om.sinks, sink)
+}
+
+// Publish 发布本进程产生的事件：分配ID，推送给订阅者并交给所有 sink
+func (om *ObserverManager) Publish(event model.TaskEvent) model.TaskEvent {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	om.mutex.Lock()
+	om.nextID++
+	event.ID = om.nextID
+	om.dispatch(event)
+	sinks := om.sinks
+	om.mutex.Unlock()
+
+	for _, sink := range sinks {
+		sink(event)
+	}
+	return event
+}
+
+// Deliver 转发其他进程产生的事件（例如从数据库读取的 worker 事件），保留原有ID，不经过 sink
+func (om *ObserverManager) Deliver(event model.TaskEvent) {
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+
+	om.dispatch(event)
+}
+
+// dispatch 记录事件历史并非阻塞地推送给订阅者，调用方需持有写锁
+func (om *ObserverManager) dispatch(event model.TaskEvent) {
+	history := append(om.history[event.TaskID], event)
+	if len(history) > maxEventHistory {
+		history = history[len(history)-maxEventHistory:]
+	}
+	om.history[event.TaskID] = history
+
+	for sub := range om.subscribers[event.TaskID] {
+		if event.ID <= sub.lastID {
+			continue
+		}
+		select {
+		case sub.events <- event:
+			sub.lastID = event.ID
+		default:
+			// 订阅者消费太慢，关闭订阅，由客户端带上最后的事件ID重新连接
+			log.Printf("Event subscriber of task %s is too slow, dropping it", event.TaskID)
+			om.unsubscribe(sub)
+		}
+	}
+}
+
+// Subscribe 订阅任务事件，返回ID大于afterID的历史事件用于回放，之后的事件从 Events 推送
+func (om *ObserverManager) Subscribe(taskID string, afterID int64) (*Subscription, []model.TaskEvent) {
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+
+	var replay []model.TaskEvent
+	for _, event := range om.history[taskID] {
+		if event.ID > afterID {
+			replay = append(replay, event)
+		}
+	}
+
+	events := make(chan model.TaskEvent, subscriberBuffer)
+	sub := &Subscription{TaskID: taskID, Events: events, events: events, lastID: afterID}
+	if len(replay) > 0 {
+		sub.lastID = replay[len(replay)-1].ID
+	}
+
+	if om.subscribers[taskID] == nil {
+		om.subscribers[taskID] = make(map[*Subscription]struct{})
+	}
+	om.subscribers[taskID][sub] = struct{}{}
+	return sub, replay
+}
+
+// Unsubscribe 取消订阅并关闭 Events，重复调用是安全的
+func (om *ObserverManager) Unsubscribe(sub *Subscription) {
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+
+	om.unsubscribe(sub)
+}
+
+func (om *ObserverManager) unsubscribe(sub *Subscription) {
+	subs, ok := om.subscribers[sub.TaskID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.events)
+	if len(subs) == 0 {
+		delete(om.subscribers, sub.TaskID)
+	}
+}
+
+// SubscriberCount 返回任务当前的订阅者数量
+func (om *ObserverManager) SubscriberCount(taskID string) int {
+	om.mutex.RLock()
+	defer om.mutex.RUnlock()
+
+	return len(om.subscribers[taskID])
+}
+
 // Helper function to update task progress during video processing
 func UpdateTaskProgress(taskID string, step string, progress int) {
 	message := fmt.Sprintf("Processing: %s", step)
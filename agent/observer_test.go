@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"testing"
+
+	"video-agent-go/model"
+)
+
+func TestLaggingSubscriberReconnectsFromHistory(t *testing.T) {
+	om := &ObserverManager{
+		observers:   make(map[string]*TaskObserver),
+		history:     make(map[string][]model.TaskEvent),
+		subscribers: make(map[string]map[*Subscription]struct{}),
+	}
+	sub, _ := om.Subscribe("task", 0)
+
+	// A relay delivers a batch larger than the subscriber buffer while nobody reads
+	const batch = 2 * subscriberBuffer
+	for id := int64(1); id <= batch; id++ {
+		om.Deliver(model.TaskEvent{ID: id, TaskID: "task", Type: model.EventStatus})
+	}
+
+	var lastID int64
+	for event := range sub.Events {
+		lastID = event.ID
+	}
+	if lastID != subscriberBuffer {
+		t.Fatalf("dropped subscriber received up to event %d, want %d", lastID, subscriberBuffer)
+	}
+
+	// Reconnecting with the last seen ID replays the rest from history
+	resumed, replay := om.Subscribe("task", lastID)
+	defer om.Unsubscribe(resumed)
+	if len(replay) != batch-subscriberBuffer {
+		t.Fatalf("got %d replayed events, want %d", len(replay), batch-subscriberBuffer)
+	}
+	if replay[0].ID != lastID+1 || replay[len(replay)-1].ID != batch {
+		t.Fatalf("replay covers events %d..%d, want %d..%d", replay[0].ID, replay[len(replay)-1].ID, lastID+1, batch)
+	}
+}
@@ -1,21 +1,26 @@
 package agent
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"video-agent-go/config"
+	"time"
 	"video-agent-go/model"
 )
 
 // AgentOrchestrator LLM驱动的智能编排器
 type AgentOrchestrator struct {
+	llm             LLMProvider
 	availableAgents map[string]SubAgent
 	executionLog    []ExecutionStep
 	context         *OrchestrationContext
+
+	// Checkpoints 保存各阶段产物；Resume 为上次失败前已生成的脚本和素材
+	Checkpoints Checkpointer
+	Resume      *model.ScriptOutput
+	// Recorder 持久化每个执行步骤
+	Recorder ExecutionRecorder
 }
 
 // SubAgent 子智能体接口
@@ -23,7 +28,8 @@ type SubAgent interface {
 	GetName() string
 	GetDescription() string
 	GetCapabilities() []string
-	Execute(ctx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error)
+	// Execute 执行智能体，ctx 取消时应尽快返回 ctx.Err()
+	Execute(ctx context.Context, octx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error)
 	CanHandle(task string, context *OrchestrationContext) bool
 }
 
@@ -34,6 +40,13 @@ type OrchestrationContext struct {
 	CurrentState  map[string]interface{} `json:"current_state"`
 	ExecutedSteps []ExecutionStep        `json:"executed_steps"`
 	Resources     map[string]string      `json:"resources"` // 存储生成的文件路径等
+	Checkpoints   Checkpointer           `json:"-"`
+}
+
+// Script 返回 ScriptGenerator 写入的脚本，后续智能体会把素材路径写回其中
+func (c *OrchestrationContext) Script() (*model.ScriptOutput, bool) {
+	script, ok := c.CurrentState["script"].(*model.ScriptOutput)
+	return script, ok && script != nil
 }
 
 // ExecutionStep 执行步骤
@@ -81,18 +94,15 @@ type PlannedStep struct {
 // NewOrchestrator 创建新的编排器
 func NewOrchestrator() *AgentOrchestrator {
 	orchestrator := &AgentOrchestrator{
+		llm:             GetLLMProvider(),
 		availableAgents: make(map[string]SubAgent),
 		executionLog:    make([]ExecutionStep, 0),
 	}
 
 	// 注册各种子智能体
-	orchestrator.RegisterAgent(&ScriptGeneratorAgent{})
-	orchestrator.RegisterAgent(&ImageGeneratorAgent{})
-	orchestrator.RegisterAgent(&VoiceGeneratorAgent{})
-	orchestrator.RegisterAgent(&VideoRenderAgent{})
-	orchestrator.RegisterAgent(&AnalysisAgent{})
-	orchestrator.RegisterAgent(&QualityCheckAgent{})
-	orchestrator.RegisterAgent(&OptimizationAgent{})
+	for _, agent := range defaultSubAgents() {
+		orchestrator.RegisterAgent(agent)
+	}
 
 	return orchestrator
 }
@@ -103,8 +113,17 @@ func (o *AgentOrchestrator) RegisterAgent(agent SubAgent) {
 	log.Printf("Registered agent: %s", agent.GetName())
 }
 
+// Agents 返回已注册智能体的描述，按名称排序
+func (o *AgentOrchestrator) Agents() []AgentInfo {
+	agents := make([]SubAgent, 0, len(o.availableAgents))
+	for _, agent := range o.availableAgents {
+		agents = append(agents, agent)
+	}
+	return agentInfos(agents)
+}
+
 // ProcessTask 处理任务 - LLM驱动的主流程
-func (o *AgentOrchestrator) ProcessTask(taskID string, input model.UserInput) (*model.ScriptOutput, error) {
+func (o *AgentOrchestrator) ProcessTask(ctx context.Context, taskID string, input model.UserInput) (*model.ScriptOutput, error) {
 	// 初始化上下文
 	o.context = &OrchestrationContext{
 		TaskID:        taskID,
@@ -112,12 +131,20 @@ func (o *AgentOrchestrator) ProcessTask(taskID string, input model.UserInput) (*
 		CurrentState:  make(map[string]interface{}),
 		ExecutedSteps: make([]ExecutionStep, 0),
 		Resources:     make(map[string]string),
+		Checkpoints:   checkpointerOrNoop(o.Checkpoints),
+	}
+
+	// 从上次失败的位置继续：已有的脚本和素材直接放入上下文，智能体会跳过已完成的镜头
+	if o.Resume != nil {
+		o.context.CurrentState["script"] = o.Resume
+		o.context.Resources = resumeResources(o.Resume)
+		log.Printf("♻️ Resuming task %s with %d checkpointed resources", taskID, len(o.context.Resources))
 	}
 
 	log.Printf("🚀 Starting LLM-driven orchestration for task: %s", taskID)
 
 	// Step 1: LLM 分析任务并生成执行计划
-	plan, err := o.generateExecutionPlan()
+	plan, err := o.generateExecutionPlan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate execution plan: %v", err)
 	}
@@ -125,7 +152,7 @@ func (o *AgentOrchestrator) ProcessTask(taskID string, input model.UserInput) (*
 	log.Printf("📋 Execution plan generated: %s", plan.Strategy)
 
 	// Step 2: 执行计划
-	result, err := o.executePlan(plan)
+	result, err := o.executePlan(ctx, plan)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute plan: %v", err)
 	}
@@ -135,69 +162,31 @@ func (o *AgentOrchestrator) ProcessTask(taskID string, input model.UserInput) (*
 }
 
 // generateExecutionPlan LLM生成执行计划
-func (o *AgentOrchestrator) generateExecutionPlan() (*ExecutionPlan, error) {
+func (o *AgentOrchestrator) generateExecutionPlan(ctx context.Context) (*ExecutionPlan, error) {
 	// 构建提示词
 	prompt := o.buildPlanningPrompt()
 
 	// 调用LLM
-	reqBody := OpenAIRequest{
-		Model: "gpt-4",
-		Messages: []Message{
-			{
-				Role: "system",
-				Content: `You are an intelligent video generation orchestrator. Analyze the user's request and generate a detailed execution plan using available agents.
+	messages := []Message{
+		{
+			Role: "system",
+			Content: fmt.Sprintf(`You are an intelligent video generation orchestrator. Analyze the user's request and generate a detailed execution plan using available agents.
 
 Available Agents:
-- ScriptGenerator: Creates video scripts and storyboards
-- ImageGenerator: Generates images using DALL-E
-- VoiceGenerator: Creates voiceovers using TTS
-- VideoRender: Renders and combines media into final video  
-- Analysis: Analyzes content for optimization
-- QualityCheck: Validates output quality
-- Optimization: Improves and refines content
-
-Return a JSON execution plan with reasoning for each step.`,
-			},
-			{Role: "user", Content: prompt},
-		},
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
+%s
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.AppConfig.API.OpenAIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+Return a JSON execution plan with reasoning for each step.`, describeAgents(o.Agents())),
+		},
+		{Role: "user", Content: prompt},
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	content, err := o.llm.Chat(ctx, StagePlanning, messages)
 	if err != nil {
 		return nil, err
 	}
 
-	var openAIResp OpenAIResponse
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return nil, err
-	}
-
-	if len(openAIResp.Choices) == 0 {
-		return nil, fmt.Errorf("no response from OpenAI")
-	}
-
 	var plan ExecutionPlan
-	if err := json.Unmarshal([]byte(openAIResp.Choices[0].Message.Content), &plan); err != nil {
+	if err := json.Unmarshal([]byte(content), &plan); err != nil {
 		return nil, err
 	}
 
@@ -243,12 +232,17 @@ Generate a detailed JSON execution plan with clear reasoning for agent selection
 }
 
 // executePlan 执行LLM生成的计划
-func (o *AgentOrchestrator) executePlan(plan *ExecutionPlan) (*model.ScriptOutput, error) {
+func (o *AgentOrchestrator) executePlan(ctx context.Context, plan *ExecutionPlan) (*model.ScriptOutput, error) {
 	log.Printf("🎯 Executing plan: %s", plan.Strategy)
 
 	var finalResult *model.ScriptOutput
 
 	for _, step := range plan.Steps {
+		// 任务被取消时不再执行后续步骤
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// 检查执行条件
 		if step.Condition != "" && !o.evaluateCondition(step.Condition) {
 			log.Printf("⏭️  Skipping step %s: condition not met", step.StepID)
@@ -274,8 +268,11 @@ func (o *AgentOrchestrator) executePlan(plan *ExecutionPlan) (*model.ScriptOutpu
 		}
 
 		// 执行代理
-		result, err := o.executeAgent(agent, step)
+		result, err := o.executeAgent(ctx, agent, step)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			if step.Optional {
 				log.Printf("⚠️  Optional step failed: %v", err)
 				continue
@@ -303,16 +300,20 @@ func (o *AgentOrchestrator) executePlan(plan *ExecutionPlan) (*model.ScriptOutpu
 		}
 	}
 
+	if finalResult == nil {
+		return nil, fmt.Errorf("plan finished without rendering a video")
+	}
+
 	return finalResult, nil
 }
 
 // executeAgent 执行单个智能体
-func (o *AgentOrchestrator) executeAgent(agent SubAgent, step PlannedStep) (*AgentResult, error) {
-	startTime := getCurrentTimestamp()
+func (o *AgentOrchestrator) executeAgent(ctx context.Context, agent SubAgent, step PlannedStep) (*AgentResult, error) {
+	startTime := time.Now()
 
-	result, err := agent.Execute(o.context, step.Parameters)
+	result, err := agent.Execute(ctx, o.context, step.Parameters)
 
-	duration := getCurrentTimestamp() - startTime
+	duration := time.Since(startTime).Milliseconds()
 
 	// 记录执行步骤
 	execStep := ExecutionStep{
@@ -321,7 +322,7 @@ func (o *AgentOrchestrator) executeAgent(agent SubAgent, step PlannedStep) (*Age
 		Action:     step.Action,
 		Parameters: step.Parameters,
 		Result:     result,
-		Timestamp:  startTime,
+		Timestamp:  startTime.Unix(),
 		Duration:   duration,
 		Success:    err == nil,
 	}
@@ -332,6 +333,18 @@ func (o *AgentOrchestrator) executeAgent(agent SubAgent, step PlannedStep) (*Age
 
 	o.executionLog = append(o.executionLog, execStep)
 	o.context.ExecutedSteps = append(o.context.ExecutedSteps, execStep)
+	recorderOrNoop(o.Recorder).RecordExecution(stepRecord(o.context.TaskID, execStep, startTime))
+
+	message := fmt.Sprintf("%s.%s succeeded", step.AgentName, step.Action)
+	if err != nil {
+		message = fmt.Sprintf("%s.%s failed: %v", step.AgentName, step.Action, err)
+	}
+	observerManager.Publish(model.TaskEvent{
+		TaskID:  o.context.TaskID,
+		Type:    model.EventAgentStep,
+		Message: message,
+		Data:    execStep,
+	})
 
 	return result, err
 }
@@ -430,15 +443,12 @@ func (o *AgentOrchestrator) checkDependencies(dependencies []string) bool {
 
 func (o *AgentOrchestrator) buildFinalResult(result *AgentResult) *model.ScriptOutput {
 	// 从结果和上下文构建最终输出
-	return &model.ScriptOutput{
-		Title:  fmt.Sprintf("%v", o.context.CurrentState["title"]),
-		Style:  fmt.Sprintf("%v", o.context.CurrentState["style"]),
-		Final:  o.context.Resources["final_video"],
-		TaskID: o.context.TaskID,
-		Status: "completed",
+	output := &model.ScriptOutput{}
+	if script, ok := o.context.Script(); ok {
+		*output = *script
 	}
-}
-
-func getCurrentTimestamp() int64 {
-	return 0 // 简化实现
+	output.Final = o.context.Resources["final_video"]
+	output.TaskID = o.context.TaskID
+	output.Status = "completed"
+	return output
 }
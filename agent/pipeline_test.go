@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"video-agent-go/config"
+	"video-agent-go/internal/fakeopenai"
+	"video-agent-go/model"
+)
+
+// useFakeOpenAI points every provider call at a fresh fake server and runs
+// the test in an empty directory, since generated files go under ./uploads
+// and ./temp.
+func useFakeOpenAI(t *testing.T) *fakeopenai.Server {
+	t.Helper()
+
+	srv := fakeopenai.New()
+	t.Cleanup(srv.Close)
+
+	prev := config.AppConfig
+	config.AppConfig = srv.Config()
+	SetLLMProvider(nil)
+	t.Cleanup(func() {
+		config.AppConfig = prev
+		SetLLMProvider(nil)
+	})
+
+	chdir(t, t.TempDir())
+	return srv
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// requireFFmpeg skips tests that render when ffmpeg is not installed.
+func requireFFmpeg(t *testing.T) {
+	t.Helper()
+
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestGenerateMediaFromFakeServer(t *testing.T) {
+	useFakeOpenAI(t)
+	ctx := testContext(t)
+
+	imagePath, err := GenerateImage(ctx, "A sunrise over a quiet city skyline")
+	if err != nil {
+		t.Fatalf("GenerateImage: %v", err)
+	}
+	if info, err := os.Stat(imagePath); err != nil || info.Size() == 0 {
+		t.Fatalf("image %s was not saved: %v", imagePath, err)
+	}
+
+	voicePath, err := GenerateVoiceover(ctx, "Every day starts with a single light.")
+	if err != nil {
+		t.Fatalf("GenerateVoiceover: %v", err)
+	}
+	if info, err := os.Stat(voicePath); err != nil || info.Size() == 0 {
+		t.Fatalf("voice %s was not saved: %v", voicePath, err)
+	}
+}
+
+func TestSmartPipelineRendersVideo(t *testing.T) {
+	requireFFmpeg(t)
+	useFakeOpenAI(t)
+
+	orchestrator := NewOrchestrator()
+	result, err := orchestrator.ProcessTask(testContext(t), "test-smart", model.UserInput{Text: "A day in the city"})
+	if err != nil {
+		t.Fatalf("ProcessTask: %v", err)
+	}
+	checkRendered(t, result)
+}
+
+func TestToolPipelineRendersVideo(t *testing.T) {
+	requireFFmpeg(t)
+	useFakeOpenAI(t)
+
+	orchestrator := NewToolBasedOrchestrator()
+	result, err := orchestrator.ProcessTask(testContext(t), "test-tools", "A day in the city")
+	if err != nil {
+		t.Fatalf("ProcessTask: %v", err)
+	}
+	checkRendered(t, result)
+}
+
+func checkRendered(t *testing.T, result *model.ScriptOutput) {
+	t.Helper()
+
+	if result == nil || result.Final == "" {
+		t.Fatalf("no final video in result %+v", result)
+	}
+	if info, err := os.Stat(result.Final); err != nil || info.Size() == 0 {
+		t.Fatalf("final video %s was not written: %v", result.Final, err)
+	}
+	if len(result.Shots) != 2 {
+		t.Errorf("got %d shots, want the 2 of the default script", len(result.Shots))
+	}
+	for i, shot := range result.Shots {
+		if shot.ClipPath == "" || shot.VoicePath == "" {
+			t.Errorf("shot %d is missing assets: image %q, voice %q", i, shot.ClipPath, shot.VoicePath)
+		}
+	}
+}
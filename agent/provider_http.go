@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"video-agent-go/config"
+)
+
+// ProviderErrorKind 外部服务调用失败的分类
+type ProviderErrorKind string
+
+const (
+	ErrKindRateLimited    ProviderErrorKind = "rate_limited"
+	ErrKindQuota          ProviderErrorKind = "quota_exceeded"
+	ErrKindInvalidRequest ProviderErrorKind = "invalid_request"
+	ErrKindServer         ProviderErrorKind = "server_error"
+	ErrKindTimeout        ProviderErrorKind = "timeout"
+)
+
+// ProviderError 外部服务调用的类型化错误
+type ProviderError struct {
+	Kind       ProviderErrorKind
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("provider %s (%d): %s", e.Kind, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("provider %s: %s", e.Kind, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable 限流、服务端错误和超时可以重试，额度不足和请求错误重试也没有意义
+func (e *ProviderError) Retryable() bool {
+	switch e.Kind {
+	case ErrKindRateLimited, ErrKindServer, ErrKindTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsProviderError 判断err是否为指定类型的ProviderError
+func IsProviderError(err error, kind ProviderErrorKind) bool {
+	var providerErr *ProviderError
+	return errors.As(err, &providerErr) && providerErr.Kind == kind
+}
+
+// ProviderClient 所有外部服务调用共用的HTTP层：单次尝试超时、整体调用期限、错误分类、带抖动的指数退避重试
+type ProviderClient struct {
+	APIKey     string
+	Timeout    time.Duration // 单次尝试的超时
+	Deadline   time.Duration // 整个调用的期限，包含所有重试和等待
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	client     *http.Client
+}
+
+// NewProviderClient 根据API配置创建客户端，timeout为单次尝试的超时，deadline为整个调用的期限
+func NewProviderClient(cfg config.APIConfig, timeout, deadline time.Duration) *ProviderClient {
+	return &ProviderClient{
+		APIKey:     cfg.OpenAIKey,
+		Timeout:    timeout,
+		Deadline:   deadline,
+		MaxRetries: cfg.MaxRetries,
+		BaseDelay:  cfg.RetryBaseDelay,
+		MaxDelay:   cfg.RetryMaxDelay,
+		client:     &http.Client{},
+	}
+}
+
+// PostJSON 发送带鉴权的JSON请求，成功时返回响应体
+func (c *ProviderClient) PostJSON(ctx context.Context, url string, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, "POST", url, body, true)
+}
+
+// Get 下载资源（例如生成图片的临时URL），不携带API密钥
+func (c *ProviderClient) Get(ctx context.Context, url string) ([]byte, error) {
+	return c.send(ctx, "GET", url, nil, false)
+}
+
+func (c *ProviderClient) send(ctx context.Context, method, url string, body []byte, auth bool) ([]byte, error) {
+	callCtx := ctx
+	if c.Deadline > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.Deadline)
+		defer cancel()
+	}
+
+	var lastErr *ProviderError
+
+	for attempt := 0; ; attempt++ {
+		respBody, err := c.attempt(callCtx, method, url, body, auth)
+		if err == nil {
+			return respBody, nil
+		}
+
+		// 上层取消或整个调用到期时直接返回，不再重试
+		if callCtx.Err() != nil {
+			return nil, c.stopped(ctx, method, url)
+		}
+
+		var providerErr *ProviderError
+		if !errors.As(err, &providerErr) {
+			return nil, err
+		}
+		lastErr = providerErr
+
+		if !providerErr.Retryable() || attempt >= c.MaxRetries {
+			break
+		}
+		// 服务端要求的等待时间超过允许的最长间隔时不再重试，直接返回限流错误
+		if c.MaxDelay > 0 && providerErr.RetryAfter > c.MaxDelay {
+			log.Printf("Provider call %s %s failed (%v), Retry-After %v exceeds the %v limit, giving up", method, url, providerErr, providerErr.RetryAfter, c.MaxDelay)
+			break
+		}
+
+		delay := c.backoff(attempt, providerErr.RetryAfter)
+		// 等待结束前调用就会到期时不再重试，返回最后一次的错误
+		if deadline, ok := callCtx.Deadline(); ok && time.Until(deadline) < delay {
+			log.Printf("Provider call %s %s failed (%v), retrying in %v would exceed the call deadline, giving up", method, url, providerErr, delay)
+			break
+		}
+		log.Printf("Provider call %s %s failed (%v), retrying in %v (%d/%d)", method, url, providerErr, delay, attempt+1, c.MaxRetries)
+
+		select {
+		case <-callCtx.Done():
+			return nil, c.stopped(ctx, method, url)
+		case <-time.After(delay):
+		}
+	}
+
+	return nil, lastErr
+}
+
+// stopped 上层ctx结束时返回其错误，否则说明整个调用超过了Deadline
+func (c *ProviderClient) stopped(ctx context.Context, method, url string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return &ProviderError{
+		Kind:    ErrKindTimeout,
+		Message: fmt.Sprintf("%s %s did not succeed within %v", method, url, c.Deadline),
+		Err:     context.DeadlineExceeded,
+	}
+}
+
+// attempt 执行一次请求，读取完整响应体后才释放单次超时
+func (c *ProviderClient) attempt(ctx context.Context, method, url string, body []byte, auth bool) ([]byte, error) {
+	attemptCtx := ctx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(attemptCtx, method, url, reader)
+	if err != nil {
+		return nil, &ProviderError{Kind: ErrKindInvalidRequest, Message: err.Error(), Err: err}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth && c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, classifyTransportError(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, classifyTransportError(err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, classifyHTTPError(resp, respBody)
+	}
+
+	return respBody, nil
+}
+
+// backoff 计算第attempt次失败后的等待时间，服务端给出Retry-After时按其等待
+func (c *ProviderClient) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	if retryAfter < 0 {
+		return 0
+	}
+
+	delay := c.BaseDelay << uint(attempt)
+	if c.MaxDelay > 0 && (delay > c.MaxDelay || delay <= 0) {
+		delay = c.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// 抖动区间 [delay/2, delay)，避免并发任务同时重试
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+func classifyTransportError(err error) *ProviderError {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &ProviderError{Kind: ErrKindTimeout, Message: err.Error(), Err: err}
+	}
+	// 连接被拒绝、连接重置等网络错误按服务端错误处理，允许重试
+	return &ProviderError{Kind: ErrKindServer, Message: err.Error(), Err: err}
+}
+
+func classifyHTTPError(resp *http.Response, body []byte) *ProviderError {
+	var apiErr struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	message := string(body)
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+		message = apiErr.Error.Message
+	}
+
+	providerErr := &ProviderError{StatusCode: resp.StatusCode, Message: message}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if apiErr.Error.Code == "insufficient_quota" || apiErr.Error.Type == "insufficient_quota" {
+			providerErr.Kind = ErrKindQuota
+		} else {
+			providerErr.Kind = ErrKindRateLimited
+			providerErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusGatewayTimeout:
+		providerErr.Kind = ErrKindTimeout
+	case resp.StatusCode >= 500:
+		providerErr.Kind = ErrKindServer
+		providerErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	default:
+		providerErr.Kind = ErrKindInvalidRequest
+	}
+
+	return providerErr
+}
+
+// parseRetryAfter 解析秒数或HTTP日期格式的Retry-After，"0" 返回负数表示立即重试
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return -1
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClassifyHTTPError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		kind       ProviderErrorKind
+		wait       time.Duration
+		message    string
+	}{
+		{"rate limited", 429, "7", `{"error":{"message":"slow down","type":"requests"}}`, ErrKindRateLimited, 7 * time.Second, "slow down"},
+		{"rate limited now", 429, "0", `{"error":{"message":"slow down"}}`, ErrKindRateLimited, -1, "slow down"},
+		{"quota by code", 429, "30", `{"error":{"message":"no credit","code":"insufficient_quota"}}`, ErrKindQuota, 0, "no credit"},
+		{"quota by type", 429, "", `{"error":{"message":"no credit","type":"insufficient_quota"}}`, ErrKindQuota, 0, "no credit"},
+		{"request timeout", 408, "", "timeout", ErrKindTimeout, 0, "timeout"},
+		{"gateway timeout", 504, "", "upstream timed out", ErrKindTimeout, 0, "upstream timed out"},
+		{"server error", 500, "", `{"error":{"message":"boom"}}`, ErrKindServer, 0, "boom"},
+		{"unavailable", 503, "2", "busy", ErrKindServer, 2 * time.Second, "busy"},
+		{"bad request", 400, "", `{"error":{"message":"bad model"}}`, ErrKindInvalidRequest, 0, "bad model"},
+		{"unauthorized", 401, "", "not json", ErrKindInvalidRequest, 0, "not json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			err := classifyHTTPError(resp, []byte(tt.body))
+			if err.Kind != tt.kind || err.StatusCode != tt.status {
+				t.Errorf("got %s (%d), want %s (%d)", err.Kind, err.StatusCode, tt.kind, tt.status)
+			}
+			if err.RetryAfter != tt.wait {
+				t.Errorf("got Retry-After %v, want %v", err.RetryAfter, tt.wait)
+			}
+			if err.Message != tt.message {
+				t.Errorf("got message %q, want %q", err.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", -1},
+		{"-3", -1},
+		{"1", time.Second},
+		{"120", 2 * time.Minute},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), -1},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	// HTTP dates have second precision and are measured from now
+	date := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 88*time.Second || got > 90*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v, want about 90s", date, got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &ProviderClient{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	if got := c.backoff(0, 5*time.Second); got != 5*time.Second {
+		t.Errorf("Retry-After 5s waits %v, want the full 5s", got)
+	}
+	if got := c.backoff(3, -1); got != 0 {
+		t.Errorf("Retry-After 0 waits %v, want no wait", got)
+	}
+
+	tests := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second}, // capped
+		{70, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := c.backoff(tt.attempt, 0)
+			if got < tt.delay/2 || got > tt.delay {
+				t.Fatalf("attempt %d waits %v, want between %v and %v", tt.attempt, got, tt.delay/2, tt.delay)
+			}
+		}
+	}
+
+	if got := (&ProviderClient{}).backoff(2, 0); got != 0 {
+		t.Errorf("without delays waits %v, want no wait", got)
+	}
+}
+
+func TestSendHonorsRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		requests   int32
+		wantErr    bool
+	}{
+		{"retries immediately", "0", 2, false},
+		{"retries within the limit", "1", 2, false},
+		{"gives up beyond the limit", "60", 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					w.Write([]byte(`{"error":{"message":"slow down"}}`))
+					return
+				}
+				w.Write([]byte(`{}`))
+			}))
+			defer srv.Close()
+
+			c := &ProviderClient{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second, client: srv.Client()}
+			_, err := c.PostJSON(context.Background(), srv.URL, map[string]string{})
+
+			if got := atomic.LoadInt32(&requests); got != tt.requests {
+				t.Errorf("made %d requests, want %d", got, tt.requests)
+			}
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("got error %v, want success after a retry", err)
+				}
+				return
+			}
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) || providerErr.Kind != ErrKindRateLimited || providerErr.RetryAfter != time.Minute {
+				t.Errorf("got error %v, want rate limited with Retry-After 1m", err)
+			}
+		})
+	}
+}
+
+func TestSendStopsAtCallDeadline(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// Hang until the test is over
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := &ProviderClient{Deadline: 200 * time.Millisecond, MaxRetries: 10, BaseDelay: time.Millisecond, client: srv.Client()}
+	start := time.Now()
+	_, err := c.PostJSON(context.Background(), srv.URL, map[string]string{})
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call took %v, want it to stop at the 200ms deadline", elapsed)
+	}
+	if !IsProviderError(err, ErrKindTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want a timeout wrapping context.DeadlineExceeded", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("made %d requests, want 2", got)
+	}
+}
+
+func TestSendSkipsRetryBeyondCallDeadline(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := &ProviderClient{Deadline: 100 * time.Millisecond, MaxRetries: 3, BaseDelay: time.Second, MaxDelay: time.Second, client: srv.Client()}
+	start := time.Now()
+	_, err := c.PostJSON(context.Background(), srv.URL, map[string]string{})
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("call took %v, want it to give up without waiting", elapsed)
+	}
+	if !IsProviderError(err, ErrKindServer) {
+		t.Errorf("got error %v, want the last server error", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("made %d requests, want 1", got)
+	}
+}
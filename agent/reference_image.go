@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"video-agent-go/model"
+)
+
+// 用户提供的图像统一到与默认生成图像相同的画幅，保证所有镜头片段分辨率一致
+const (
+	frameWidth  = 1024
+	frameHeight = 1024
+)
+
+// maxCropRatio 画幅差异在该比例以内时裁剪填满，否则加边保留完整画面
+const maxCropRatio = 1.25
+
+// ReferenceImage 镜头通过 image_ref 指定了用户提供的图像时，返回规范化后的本地图像路径；
+// 未指定时返回空字符串，调用方应继续生成图像。URL 只从公网地址下载，大小受上传上限约束
+func ReferenceImage(ctx context.Context, shot model.Shot, images []string) (string, error) {
+	if shot.ImageRef <= 0 {
+		return "", nil
+	}
+	if shot.ImageRef > len(images) {
+		return "", fmt.Errorf("image_ref %d is out of range, %d images provided", shot.ImageRef, len(images))
+	}
+
+	source := images[shot.ImageRef-1]
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		downloaded, err := downloadMedia(ctx, source, "temp", "reference")
+		if err != nil {
+			return "", fmt.Errorf("failed to download reference image: %w", err)
+		}
+		defer os.Remove(downloaded)
+		source = downloaded
+	}
+
+	output := filepath.Join("uploads", "images", fmt.Sprintf("ref_%d.jpg", time.Now().UnixNano()))
+	if err := NormalizeImage(ctx, source, output); err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// NormalizeImage 按 EXIF 方向摆正图像，再裁剪或加边到目标画幅
+func NormalizeImage(ctx context.Context, src, dst string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	orientation := exifOrientation(file)
+	file.Seek(0, io.SeekStart)
+	cfg, _, decodeErr := image.DecodeConfig(file)
+	file.Close()
+
+	filters := orientationFilters(orientation)
+	width, height := cfg.Width, cfg.Height
+	if orientation >= 5 {
+		// 5-8 方向需要转置，摆正后宽高互换
+		width, height = height, width
+	}
+	filters = append(filters, fitFilters(width, height, decodeErr == nil)...)
+	filters = append(filters, "setsar=1")
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	// -noautorotate 避免 ffmpeg 自行处理方向后与上面的滤镜重复旋转
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-noautorotate",
+		"-i", src,
+		"-vf", strings.Join(filters, ","),
+		"-frames:v", "1",
+		"-q:v", "2",
+		"-y", dst)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("ffmpeg error normalizing %s: %v: %s", src, err, lastLine(output))
+	}
+	return nil
+}
+
+// fitFilters 画幅接近时裁剪填满，差异较大（例如竖拍照片放进横屏）时等比缩放后加黑边。
+// 无法读取尺寸时按加边处理，保证不丢失画面内容
+func fitFilters(width, height int, known bool) []string {
+	crop := false
+	if known && width > 0 && height > 0 {
+		ratio := (float64(width) / float64(height)) / (float64(frameWidth) / float64(frameHeight))
+		crop = ratio <= maxCropRatio && ratio >= 1/maxCropRatio
+	}
+
+	if crop {
+		return []string{
+			fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase", frameWidth, frameHeight),
+			fmt.Sprintf("crop=%d:%d", frameWidth, frameHeight),
+		}
+	}
+	return []string{
+		fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", frameWidth, frameHeight),
+		fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=black", frameWidth, frameHeight),
+	}
+}
+
+// orientationFilters 把 EXIF 方向值转换为 ffmpeg 滤镜
+func orientationFilters(orientation int) []string {
+	switch orientation {
+	case 2:
+		return []string{"hflip"}
+	case 3:
+		return []string{"hflip", "vflip"}
+	case 4:
+		return []string{"vflip"}
+	case 5:
+		return []string{"transpose=0"}
+	case 6:
+		return []string{"transpose=1"}
+	case 7:
+		return []string{"transpose=3"}
+	case 8:
+		return []string{"transpose=2"}
+	default:
+		return nil
+	}
+}
+
+// exifOrientation 读取 JPEG 的 EXIF 方向标签(0x0112)，没有或无法解析时返回1（正常方向）
+func exifOrientation(r io.Reader) int {
+	data, err := io.ReadAll(io.LimitReader(r, 256<<10))
+	if err != nil || len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// 逐个遍历 JPEG 段，找到 APP1 中的 Exif 数据
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// 已到图像数据，后面不会再有 EXIF
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		pos = end
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// 方向标签的类型为 SHORT，值保存在值字段的前两个字节
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"video-agent-go/model"
+)
+
+// tiffWithOrientation 构造只有 IFD0 的 TIFF 头，IFD0 中先放一个无关标签再放方向标签
+func tiffWithOrientation(order binary.ByteOrder, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(&buf, order, uint16(42))
+	binary.Write(&buf, order, uint32(8))
+
+	binary.Write(&buf, order, uint16(2))
+	// ImageWidth(0x0100) LONG 640
+	binary.Write(&buf, order, []uint16{0x0100, 4})
+	binary.Write(&buf, order, []uint32{1, 640})
+	// Orientation(0x0112) SHORT
+	binary.Write(&buf, order, []uint16{0x0112, 3})
+	binary.Write(&buf, order, uint32(1))
+	binary.Write(&buf, order, []uint16{orientation, 0})
+	binary.Write(&buf, order, uint32(0))
+	return buf.Bytes()
+}
+
+// jpegSegment 按 JPEG 段格式编码，长度字段包含自身两个字节
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func jpegWithSegments(segments ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	// 图像数据之后的内容不应再被解析
+	return append(data, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9)
+}
+
+func exifSegment(tiff []byte) []byte {
+	return jpegSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func TestExifOrientation(t *testing.T) {
+	jfif := jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for orientation := uint16(1); orientation <= 8; orientation++ {
+			data := jpegWithSegments(jfif, exifSegment(tiffWithOrientation(order, orientation)))
+			if got := exifOrientation(bytes.NewReader(data)); got != int(orientation) {
+				t.Errorf("%s orientation %d: got %d", order, orientation, got)
+			}
+		}
+	}
+
+	truncated := jpegWithSegments(exifSegment(tiffWithOrientation(binary.BigEndian, 6)))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a jpeg", []byte("\x89PNG\r\n\x1a\n")},
+		{"no exif", jpegWithSegments(jfif)},
+		{"truncated segment", truncated[:len(truncated)-12]},
+		{"segment length too short", append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}, truncated[6:]...)},
+		{"truncated ifd", jpegWithSegments(exifSegment(tiffWithOrientation(binary.LittleEndian, 6)[:20]))},
+		{"unknown byte order", jpegWithSegments(exifSegment(append([]byte("XX"), tiffWithOrientation(binary.BigEndian, 6)[2:]...)))},
+		{"out of range value", jpegWithSegments(exifSegment(tiffWithOrientation(binary.BigEndian, 9)))},
+		{"exif after image data", append(jpegWithSegments(), exifSegment(tiffWithOrientation(binary.BigEndian, 6))...)},
+	}
+	for _, tt := range tests {
+		if got := exifOrientation(bytes.NewReader(tt.data)); got != 1 {
+			t.Errorf("%s: got %d, want 1", tt.name, got)
+		}
+	}
+}
+
+func TestTiffOrientation(t *testing.T) {
+	tiff := tiffWithOrientation(binary.LittleEndian, 8)
+	if got := tiffOrientation(tiff); got != 8 {
+		t.Errorf("got %d, want 8", got)
+	}
+	for _, n := range []int{0, 4, 8, 10, 21, len(tiff) - 6} {
+		if got := tiffOrientation(tiff[:n]); got != 1 {
+			t.Errorf("truncated to %d bytes: got %d, want 1", n, got)
+		}
+	}
+}
+
+func TestOrientationFilters(t *testing.T) {
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{0, nil},
+		{1, nil},
+		{2, []string{"hflip"}},
+		{3, []string{"hflip", "vflip"}},
+		{4, []string{"vflip"}},
+		{5, []string{"transpose=0"}},
+		{6, []string{"transpose=1"}},
+		{7, []string{"transpose=3"}},
+		{8, []string{"transpose=2"}},
+		{9, nil},
+	}
+	for _, tt := range tests {
+		if got := orientationFilters(tt.orientation); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("orientationFilters(%d) = %v, want %v", tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestReferenceImageRefusesPrivateURL(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	_, err := ReferenceImage(context.Background(), model.Shot{ImageRef: 1}, []string{srv.URL + "/ref.png"})
+	if err == nil || !strings.Contains(err.Error(), "non-public") {
+		t.Errorf("got %v, want the loopback reference image refused", err)
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Error("reference image download reached a loopback address")
+	}
+}
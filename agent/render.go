@@ -1,7 +1,9 @@
 package agent
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,40 +14,91 @@ import (
 	"video-agent-go/storage"
 )
 
-func RenderVideo(script model.ScriptOutput) (string, error) {
-	// Create temporary directory for processing
-	tempDir := fmt.Sprintf("temp/render_%d", time.Now().UnixNano())
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
+// RenderOptions 渲染的可选参数
+type RenderOptions struct {
+	// WorkDir 保存单镜头片段的目录，设置后片段在渲染结束后保留，供重试复用；
+	// 为空时使用临时目录并在返回前清理
+	WorkDir string
+	// OnClip 每个镜头片段渲染完成后调用
+	OnClip func(shot int, path string)
+}
+
+// RenderVideo 把每个分镜合成片段后拼接成最终视频，并按配置烧录或封装字幕，
+// 字幕文件路径记录在 script.Subtitles。ctx取消时会结束正在运行的ffmpeg，临时目录在返回前清理
+func RenderVideo(ctx context.Context, script *model.ScriptOutput) (string, error) {
+	return RenderVideoWithOptions(ctx, script, RenderOptions{})
+}
+
+// RenderVideoWithOptions 按指定参数渲染视频，已有 RenderedClip 的镜头直接复用片段
+func RenderVideoWithOptions(ctx context.Context, script *model.ScriptOutput, opts RenderOptions) (string, error) {
+	workDir := opts.WorkDir
+	if workDir == "" {
+		// Create temporary directory for processing
+		workDir = fmt.Sprintf("temp/render_%d", time.Now().UnixNano())
+		defer os.RemoveAll(workDir) // Clean up
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", err
+	}
+
+	// Time every shot by its measured voiceover before cutting clips and subtitles
+	if err := measureVoices(ctx, script); err != nil {
 		return "", err
 	}
-	defer os.RemoveAll(tempDir) // Clean up
 
 	var videoClips []string
+	var transitions []model.Transition
 
 	// Process each shot
 	for i, shot := range script.Shots {
-		clipPath, err := createVideoClip(shot, tempDir, i)
-		if err != nil {
-			fmt.Printf("Failed to create clip %d: %v\n", i, err)
+		if shot.RenderedClip != "" && fileExists(shot.RenderedClip) {
+			videoClips = append(videoClips, shot.RenderedClip)
+			transitions = append(transitions, transitionInto(*script, i))
 			continue
 		}
+
+		clipPath, err := createVideoClip(ctx, shot, workDir, i)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			// 缺少镜头会让字幕和旁白与画面错位，直接失败，已渲染的片段在重试时复用
+			log.Printf("Failed to create clip %d: %v", i, err)
+			return "", fmt.Errorf("failed to create clip %d: %w", i, err)
+		}
+		if opts.OnClip != nil {
+			opts.OnClip(i, clipPath)
+		}
 		videoClips = append(videoClips, clipPath)
+		transitions = append(transitions, transitionInto(*script, i))
 	}
 
 	if len(videoClips) == 0 {
 		return "", fmt.Errorf("no video clips generated")
 	}
 
-	// Concatenate all clips
-	finalPath, err := concatenateVideos(videoClips, script.Title)
+	// Join all clips, cross-fading where the script asks for transitions
+	joined, err := joinVideos(ctx, videoClips, transitions, workDir)
+	if err != nil {
+		return "", err
+	}
+
+	// Lay the user's narration or background music over the cut
+	mixed, err := mixUserAudio(ctx, joined, *script, workDir)
 	if err != nil {
 		return "", err
 	}
 
-	return finalPath, nil
+	subtitled, subtitles, err := addSubtitles(ctx, mixed, *script, workDir)
+	if err != nil {
+		return "", err
+	}
+	script.Subtitles = subtitles
+
+	return publishVideo(subtitled, script.Title)
 }
 
-func createVideoClip(shot model.Shot, tempDir string, index int) (string, error) {
+func createVideoClip(ctx context.Context, shot model.Shot, tempDir string, index int) (string, error) {
 	clipPath := filepath.Join(tempDir, fmt.Sprintf("clip_%d.mp4", index))
 
 	// Check if we have both image and audio
@@ -53,57 +106,200 @@ func createVideoClip(shot model.Shot, tempDir string, index int) (string, error)
 		return "", fmt.Errorf("no image for shot %d", index)
 	}
 
-	duration := shot.Duration
-	if duration <= 0 {
-		duration = 5 // default duration
+	if shot.HasSource() {
+		return createSourceClip(ctx, shot, clipPath)
 	}
 
-	var cmd *exec.Cmd
+	// Animate the still image, with the voiceover as the audio track when there is one.
+	// The length comes from the timeline so clips and subtitles line up.
+	if err := renderMotionClip(ctx, shot.ClipPath, shot.VoicePath, shotLength(shot), shotMotion(shot, index), clipPath); err != nil {
+		return "", err
+	}
+
+	return clipPath, nil
+}
 
+// createSourceClip cuts the shot's range out of the source video and lays
+// the new voiceover over it in place of the original audio.
+func createSourceClip(ctx context.Context, shot model.Shot, clipPath string) (string, error) {
+	length := fmt.Sprintf("%.3f", shot.SourceEnd-shot.SourceStart)
+
+	args := []string{
+		"-ss", fmt.Sprintf("%.3f", shot.SourceStart),
+		"-t", length,
+		"-i", shot.ClipPath,
+	}
 	if shot.VoicePath != "" {
-		// Create video with image and audio
-		cmd = exec.Command("ffmpeg",
-			"-loop", "1",
-			"-i", shot.ClipPath,
-			"-i", shot.VoicePath,
-			"-c:v", "libx264",
-			"-t", fmt.Sprintf("%d", duration),
-			"-pix_fmt", "yuv420p",
-			"-c:a", "aac",
-			"-shortest",
-			"-y", clipPath)
+		args = append(args, "-i", shot.VoicePath, "-map", "0:v:0", "-map", "1:a:0", "-af", "apad", "-c:a", "aac")
 	} else {
-		// Create video with just image
-		cmd = exec.Command("ffmpeg",
-			"-loop", "1",
-			"-i", shot.ClipPath,
-			"-c:v", "libx264",
-			"-t", fmt.Sprintf("%d", duration),
-			"-pix_fmt", "yuv420p",
-			"-y", clipPath)
+		args = append(args, "-map", "0:v:0", "-an")
 	}
+	// libx264 needs even dimensions
+	args = append(args,
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2,setsar=1",
+		"-c:v", "libx264",
+		"-pix_fmt", "yuv420p",
+		"-t", length,
+		"-y", clipPath)
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ffmpeg error: %v", err)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(clipPath)
+		return "", fmt.Errorf("ffmpeg error cutting %s: %v: %s", shot.ClipPath, err, lastLine(output))
 	}
 
 	return clipPath, nil
 }
 
-func concatenateVideos(clips []string, title string) (string, error) {
-	// Create concat file
-	concatFile := "temp/concat_list.txt"
-	file, err := os.Create(concatFile)
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// xfadeTransitions maps script transitions to ffmpeg xfade transitions
+var xfadeTransitions = map[string]string{
+	model.TransitionFade:     "fade",
+	model.TransitionDissolve: "dissolve",
+	model.TransitionWipe:     "wipeleft",
+	model.TransitionSlide:    "slideleft",
+}
+
+// joinVideos joins the clips with xfade/acrossfade, or a concat filter for
+// hard cuts. transitions[i] is the transition into clip i. Clips can differ in
+// size (generated, user and source footage) and in whether they have audio,
+// so they are normalized to the first clip's size and frame rate and clips
+// without audio get silence; overlaps shorten the timeline exactly like
+// BuildTimeline.
+func joinVideos(ctx context.Context, clips []string, transitions []model.Transition, tempDir string) (string, error) {
+	infos := make([]*SourceVideo, len(clips))
+	for i, clip := range clips {
+		info, err := ProbeVideo(ctx, clip)
+		if err != nil {
+			return "", err
+		}
+		infos[i] = info
+	}
+	width, height := infos[0].Width&^1, infos[0].Height&^1
+
+	var args []string
+	var filters []string
+	for i, clip := range clips {
+		args = append(args, "-i", clip)
+
+		filters = append(filters, fmt.Sprintf(
+			"[%d:v]fps=%d,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,format=yuv420p,settb=AVTB[v%d]",
+			i, motionFPS, width, height, width, height, i))
+		if infos[i].HasAudio {
+			filters = append(filters, fmt.Sprintf(
+				"[%d:a]aresample=44100,aformat=sample_fmts=fltp:channel_layouts=stereo,apad,atrim=duration=%.3f[a%d]",
+				i, infos[i].Duration, i))
+		} else {
+			filters = append(filters, fmt.Sprintf(
+				"anullsrc=r=44100:cl=stereo,atrim=duration=%.3f,aformat=sample_fmts=fltp:channel_layouts=stereo[a%d]",
+				infos[i].Duration, i))
+		}
+	}
+
+	video, audio := "[v0]", "[a0]"
+	length := infos[0].Duration
+	for i := 1; i < len(clips); i++ {
+		nextVideo, nextAudio := fmt.Sprintf("[vx%d]", i), fmt.Sprintf("[ax%d]", i)
+		overlap := overlapDuration(transitions[i], infos[i-1].Duration, infos[i].Duration)
+		if name, ok := xfadeTransitions[transitions[i].Type]; ok && overlap > 0 {
+			filters = append(filters,
+				fmt.Sprintf("%s[v%d]xfade=transition=%s:duration=%.3f:offset=%.3f%s",
+					video, i, name, overlap, length-overlap, nextVideo),
+				fmt.Sprintf("%s[a%d]acrossfade=d=%.3f%s", audio, i, overlap, nextAudio))
+		} else {
+			filters = append(filters,
+				fmt.Sprintf("%s[v%d]concat=n=2:v=1:a=0%s", video, i, nextVideo),
+				fmt.Sprintf("%s[a%d]concat=n=2:v=0:a=1%s", audio, i, nextAudio))
+			overlap = 0
+		}
+		video, audio = nextVideo, nextAudio
+		length += infos[i].Duration - overlap
+	}
+
+	outputPath := filepath.Join(tempDir, "joined.mp4")
+	args = append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", video,
+		"-map", audio,
+		"-c:v", "libx264",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-y", outputPath)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("failed to join videos: %v: %s", err, lastLine(output))
+	}
+
+	return outputPath, nil
+}
+
+// mixUserAudio replaces the audio of the cut with the user's narration, or
+// loops/trims the user's background music to the video length and mixes it
+// under the voiceover. Without user audio the cut is returned unchanged.
+func mixUserAudio(ctx context.Context, videoPath string, script model.ScriptOutput, tempDir string) (string, error) {
+	if script.Narration == "" && script.BGMPath == "" {
+		return videoPath, nil
+	}
+
+	info, err := ProbeVideo(ctx, videoPath)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-	defer os.Remove(concatFile)
 
-	for _, clip := range clips {
-		fmt.Fprintf(file, "file '%s'\n", clip)
+	outputPath := filepath.Join(tempDir, "mixed.mp4")
+	var args []string
+
+	if script.Narration != "" {
+		// Shot durations are fitted to the recording in whole seconds, so the
+		// cut and the recording can still differ slightly; keep the cut's length
+		args = []string{
+			"-i", videoPath,
+			"-i", script.Narration,
+			"-map", "0:v:0",
+			"-map", "1:a:0",
+			"-t", fmt.Sprintf("%.3f", info.Duration),
+		}
+	} else {
+		bgm := fmt.Sprintf("[1:a]volume=%g[bgm]", bgmVolume)
+		filter := bgm + ";[bgm]anull[a]"
+		if info.HasAudio {
+			filter = bgm + ";[0:a][bgm]amix=inputs=2:duration=first:dropout_transition=0:normalize=0[a]"
+		}
+		args = []string{
+			"-i", videoPath,
+			"-stream_loop", "-1", "-i", script.BGMPath,
+			"-filter_complex", filter,
+			"-map", "0:v:0",
+			"-map", "[a]",
+			"-t", fmt.Sprintf("%.3f", info.Duration),
+		}
 	}
 
+	args = append(args, "-c:v", "copy", "-c:a", "aac", "-y", outputPath)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("failed to mix user audio: %v: %s", err, lastLine(output))
+	}
+
+	return outputPath, nil
+}
+
+// publishVideo moves the rendered video into uploads/videos and uploads it
+// when cloud storage is configured.
+func publishVideo(videoPath, title string) (string, error) {
 	// Generate output filename
 	filename := fmt.Sprintf("final_video_%d.mp4", time.Now().UnixNano())
 	if title != "" {
@@ -118,17 +314,8 @@ func concatenateVideos(clips []string, title string) (string, error) {
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
 		return "", err
 	}
-
-	// Concatenate videos
-	cmd := exec.Command("ffmpeg",
-		"-f", "concat",
-		"-safe", "0",
-		"-i", concatFile,
-		"-c", "copy",
-		"-y", outputPath)
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to concatenate videos: %v", err)
+	if err := os.Rename(videoPath, outputPath); err != nil {
+		return "", err
 	}
 
 	// Upload to storage if using cloud storage
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"video-agent-go/model"
+)
+
+func TestRenderFailsOnMissingClip(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	script := &model.ScriptOutput{
+		Title: "Broken",
+		Shots: []model.Shot{{ImagePrompt: "A skyline", Voiceover: "Morning.", Duration: 2}},
+	}
+	var clips []int
+	_, err := RenderVideoWithOptions(testContext(t), script, RenderOptions{
+		OnClip: func(shot int, path string) { clips = append(clips, shot) },
+	})
+	if err == nil || !strings.Contains(err.Error(), "clip 0") {
+		t.Fatalf("got error %v, want the missing clip 0 reported", err)
+	}
+	if len(clips) != 0 {
+		t.Errorf("reported clips %v for a failed render", clips)
+	}
+}
+
+func TestJoinVideosNormalizesHardCuts(t *testing.T) {
+	requireFFmpeg(t)
+	ctx := testContext(t)
+	dir := t.TempDir()
+
+	// A wide clip with a voiceover followed by a square one without audio
+	wide := filepath.Join(dir, "wide.mp4")
+	square := filepath.Join(dir, "square.mp4")
+	for _, args := range [][]string{
+		{"-f", "lavfi", "-i", "testsrc=size=640x360:rate=25:duration=2", "-f", "lavfi", "-i", "sine=frequency=440:duration=2",
+			"-pix_fmt", "yuv420p", "-c:a", "aac", "-shortest", "-y", wide},
+		{"-f", "lavfi", "-i", "testsrc=size=320x320:rate=30:duration=2", "-pix_fmt", "yuv420p", "-an", "-y", square},
+	} {
+		if output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg %v: %v: %s", args, err, lastLine(output))
+		}
+	}
+
+	cut := model.Transition{Type: model.TransitionCut}
+	joined, err := joinVideos(ctx, []string{wide, square}, []model.Transition{cut, cut}, dir)
+	if err != nil {
+		t.Fatalf("joinVideos: %v", err)
+	}
+	info, err := ProbeVideo(ctx, joined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 640 || info.Height != 360 {
+		t.Errorf("joined video is %dx%d, want the 640x360 of the first clip", info.Width, info.Height)
+	}
+	if !info.HasAudio {
+		t.Error("joined video has no audio track")
+	}
+	if math.Abs(info.Duration-4) > 0.2 {
+		t.Errorf("joined video is %.3fs, want both 2s clips back to back", info.Duration)
+	}
+}
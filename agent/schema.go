@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+)
+
+// JSONSchema 结构化输出(response_format=json_schema)使用的schema描述
+type JSONSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict"`
+}
+
+// ResponseFormat chat completions 的 response_format 字段
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// SchemaFor 根据Go结构体的json标签生成JSON Schema
+// 没有 omitempty 的字段视为必填，带 schema:"-" 标签的字段不会暴露给LLM
+func SchemaFor(name string, v interface{}) *JSONSchema {
+	return &JSONSchema{
+		Name:   name,
+		Schema: schemaForType(reflect.TypeOf(v)),
+	}
+}
+
+func schemaForType(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := make([]string, 0)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || field.Tag.Get("schema") == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaForType(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -1,84 +1,169 @@
 package agent
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"video-agent-go/config"
+	"log"
+	"math"
+	"path"
+	"strings"
 	"video-agent-go/model"
 )
 
-type OpenAIRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-}
-
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type OpenAIResponse struct {
-	Choices []Choice `json:"choices"`
-}
+// maxScriptRepairs is how many times the LLM may fix an invalid script
+// before GenerateScript gives up.
+const maxScriptRepairs = 2
+
+var scriptSchema = SchemaFor("video_script", model.ScriptOutput{})
+
+// GenerateScript 根据用户输入生成脚本。提供了源视频时进入剪辑模式：先检测源视频的场景，
+// 由LLM为每个镜头选择源视频中的时间段并撰写新的旁白；提供了音频时按其用途作为旁白或背景音乐
+func GenerateScript(ctx context.Context, input model.UserInput) (*model.ScriptOutput, error) {
+	var source *SourceVideo
+	if input.Video != "" {
+		var err error
+		source, err = AnalyzeVideo(ctx, input.Video)
+		if err != nil {
+			return nil, fmt.Errorf("failed to analyze source video: %w", err)
+		}
+		log.Printf("🎞️ Source video %s: %.1fs, %d scenes", source.Path, source.Duration, len(source.Scenes))
+	}
 
-type Choice struct {
-	Message Message `json:"message"`
-}
+	audio, err := prepareUserAudio(ctx, input)
+	if err != nil {
+		return nil, err
+	}
 
-func GenerateScript(input model.UserInput) (*model.ScriptOutput, error) {
 	prompt := buildScriptPrompt(input)
-
-	reqBody := OpenAIRequest{
-		Model: "gpt-4",
-		Messages: []Message{
-			{Role: "system", Content: "You are a professional video script writer. Generate a detailed video script in JSON format."},
-			{Role: "user", Content: prompt},
-		},
+	if source != nil {
+		prompt += buildEditPrompt(source)
+	}
+	if audio != nil {
+		prompt += audio.prompt()
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
+	messages := []Message{
+		{Role: "system", Content: "You are a professional video script writer. Generate a detailed video script in JSON format."},
+		{Role: "user", Content: prompt},
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	provider := GetLLMProvider()
+
+	var problems model.ValidationErrors
+	for attempt := 0; attempt <= maxScriptRepairs; attempt++ {
+		content, err := provider.ChatJSON(ctx, StageScript, messages, scriptSchema)
+		if err != nil {
+			return nil, err
+		}
+
+		var script *model.ScriptOutput
+		script, problems = parseScript(content)
+		if script != nil {
+			problems = checkImageRefs(script, len(input.Images))
+			if source != nil {
+				problems = append(problems, checkSourceRanges(script, source)...)
+			}
+		}
+		if len(problems) == 0 {
+			if source != nil {
+				useSource(script, source)
+			}
+			if audio != nil {
+				audio.apply(script)
+			}
+			script.SubtitleFormats = input.SubtitleFormats
+			return script, nil
+		}
+
+		log.Printf("Generated script is invalid (attempt %d): %v", attempt+1, problems)
+
+		// Send the problems back so the model can repair its own output
+		messages = append(messages,
+			Message{Role: "assistant", Content: content},
+			Message{Role: "user", Content: buildRepairPrompt(problems)},
+		)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.AppConfig.API.OpenAIKey)
+	return nil, fmt.Errorf("script still invalid after %d repairs: %v", maxScriptRepairs, problems)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// parseScript decodes the first JSON object in content, tolerating markdown
+// fences and trailing prose, and validates the result.
+func parseScript(content string) (*model.ScriptOutput, model.ValidationErrors) {
+	start := strings.Index(content, "{")
+	if start < 0 {
+		return nil, model.ValidationErrors{{Field: "(root)", Message: "response does not contain a JSON object"}}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	var script model.ScriptOutput
+	if err := json.NewDecoder(strings.NewReader(content[start:])).Decode(&script); err != nil {
+		return nil, model.ValidationErrors{{Field: "(root)", Message: fmt.Sprintf("invalid JSON: %v", err)}}
 	}
 
-	var openAIResp OpenAIResponse
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return nil, err
+	if problems := script.Validate(); len(problems) > 0 {
+		return nil, problems
 	}
 
-	if len(openAIResp.Choices) == 0 {
-		return nil, fmt.Errorf("no response from OpenAI")
+	return &script, nil
+}
+
+// checkImageRefs makes sure every image_ref points at one of the images the
+// user provided.
+func checkImageRefs(script *model.ScriptOutput, images int) model.ValidationErrors {
+	var errs model.ValidationErrors
+	for i, shot := range script.Shots {
+		if shot.ImageRef < 0 || shot.ImageRef > images {
+			errs = append(errs, model.FieldError{
+				Field:   fmt.Sprintf("shots[%d].image_ref", i),
+				Message: fmt.Sprintf("must be between 0 and %d, got %d", images, shot.ImageRef),
+			})
+		}
 	}
+	return errs
+}
 
-	var script model.ScriptOutput
-	if err := json.Unmarshal([]byte(openAIResp.Choices[0].Message.Content), &script); err != nil {
-		return nil, err
+// checkSourceRanges makes sure every shot of an edit cuts a non-empty range
+// out of the source video.
+func checkSourceRanges(script *model.ScriptOutput, source *SourceVideo) model.ValidationErrors {
+	var errs model.ValidationErrors
+	for i, shot := range script.Shots {
+		field := fmt.Sprintf("shots[%d]", i)
+		switch {
+		case !shot.HasSource():
+			errs = append(errs, model.FieldError{
+				Field:   field + ".source_end",
+				Message: fmt.Sprintf("must be greater than source_start (%.2f)", shot.SourceStart),
+			})
+		case shot.SourceStart < 0 || shot.SourceEnd > source.Duration:
+			errs = append(errs, model.FieldError{
+				Field:   field,
+				Message: fmt.Sprintf("source range %.2f-%.2f is outside the video (0-%.2f)", shot.SourceStart, shot.SourceEnd, source.Duration),
+			})
+		}
 	}
+	return errs
+}
 
-	return &script, nil
+// useSource points every shot of an edit at the source video, so the image
+// stages skip them, and makes the duration match the cut.
+func useSource(script *model.ScriptOutput, source *SourceVideo) {
+	for i := range script.Shots {
+		shot := &script.Shots[i]
+		shot.ClipPath = source.Path
+		shot.ImageRef = 0
+		shot.Duration = int(math.Ceil(shot.SourceEnd - shot.SourceStart))
+	}
+}
+
+func buildRepairPrompt(problems model.ValidationErrors) string {
+	var sb strings.Builder
+	sb.WriteString("The script you returned is invalid:\n")
+	for _, p := range problems {
+		sb.WriteString(fmt.Sprintf("- %s\n", p.Error()))
+	}
+	sb.WriteString("Return the complete corrected script as a single JSON object, without markdown or commentary.")
+	return sb.String()
 }
 
 func buildScriptPrompt(input model.UserInput) string {
@@ -96,18 +181,45 @@ Please return a JSON object with the following structure:
       "image_prompt": "Detailed image generation prompt",
       "voiceover": "Voiceover text",
       "duration": 5,
-      "subtitle": "Subtitle text"
+      "subtitle": "Subtitle text",
+      "motion": {"pan": "right", "zoom_start": 1.0, "zoom_end": 1.2, "easing": "ease_in_out"},
+      "transition": {"type": "dissolve", "duration": 0.8}
     }
   ],
-  "bgm": "Background music description"
+  "bgm": "Background music description",
+  "transition": {"type": "fade", "duration": 0.5}
 }
 
-Make sure each shot is detailed and specific. The image_prompt should be very descriptive for AI image generation.`,
+Make sure each shot is detailed and specific. The image_prompt should be very descriptive for AI image generation.
+Each still image is animated with a subtle camera move described by "motion": pan is one of none, left, right, up, down;
+zoom_start and zoom_end are between 1.0 (full frame) and 2.0; easing is one of linear, ease_in, ease_out, ease_in_out.
+Vary the motion between shots to match the mood, e.g. a slow zoom in for emphasis or a pan across a landscape.
+"transition" on a shot is how it cuts in from the previous shot: type is one of cut, fade, dissolve, wipe, slide and
+duration is in seconds (at most 2). The top-level "transition" is the default for shots that don't set one.`,
 		input.Text, input.Style)
 
 	if len(input.Images) > 0 {
-		prompt += fmt.Sprintf("\nReference images provided: %d images", len(input.Images))
+		prompt += fmt.Sprintf("\n\nReference images provided: %d images\n", len(input.Images))
+		for i, image := range input.Images {
+			prompt += fmt.Sprintf("[%d] %s\n", i+1, path.Base(image))
+		}
+		prompt += `To show one of these images in a shot, set "image_ref" to its number (starting at 1). ` +
+			`Shots without "image_ref" get a generated image. Still write an image_prompt describing the shot.`
 	}
 
 	return prompt
 }
+
+func buildEditPrompt(source *SourceVideo) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n\nThis is an edit of an existing video (%.1f seconds, %dx%d). Detected scenes:\n",
+		source.Duration, source.Width, source.Height))
+	for i, scene := range source.Scenes {
+		sb.WriteString(fmt.Sprintf("[%d] %.2f - %.2f\n", i+1, scene.Start, scene.End))
+	}
+	sb.WriteString(`Every shot must use footage from this video: set "source_start" and "source_end" to the range in seconds it shows. ` +
+		`Ranges usually follow the scene boundaries above and may be shorter than a scene. ` +
+		`The voiceover replaces the original audio, so write narration that fits the length of each range. ` +
+		`image_prompt may be left empty.`)
+	return sb.String()
+}
@@ -0,0 +1,204 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"video-agent-go/internal/fakeopenai"
+	"video-agent-go/model"
+)
+
+func TestParseScript(t *testing.T) {
+	const script = `{"title":"City","style":"calm","shots":[{"scene":"Dawn","image_prompt":"A skyline","voiceover":"Morning.","duration":3}],"bgm":"piano"}`
+
+	tests := []struct {
+		name    string
+		content string
+		fields  []string
+	}{
+		{"bare object", script, nil},
+		{"json fence", "```json\n" + script + "\n```", nil},
+		{"plain fence", "```\n" + script + "\n```", nil},
+		{"leading prose", "Here is your script:\n" + script, nil},
+		{"trailing prose", script + "\n\nLet me know if you want changes to the {tone}.", nil},
+		{"no object", "Sorry, I cannot help with that.", []string{"(root)"}},
+		{"truncated", `{"title":"City","shots":[`, []string{"(root)"}},
+		{"wrong type", `{"title":"City","shots":[{"duration":"three"}]}`, []string{"(root)"}},
+		{"invalid script", `{"title":"","shots":[{"image_prompt":"A skyline","voiceover":"Morning.","duration":0}]}`,
+			[]string{"title", "shots[0].duration"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, problems := parseScript(tt.content)
+
+			var fields []string
+			for _, p := range problems {
+				fields = append(fields, p.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Fatalf("got problems %v, want fields %v", problems, tt.fields)
+			}
+			if tt.fields == nil && (parsed == nil || parsed.Title != "City" || len(parsed.Shots) != 1) {
+				t.Errorf("got script %+v, want the one in the content", parsed)
+			}
+			if tt.fields != nil && parsed != nil {
+				t.Errorf("got script %+v for invalid content", parsed)
+			}
+		})
+	}
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema := SchemaFor("video_script", model.ScriptOutput{}).Schema
+
+	if got := schema["type"]; got != "object" {
+		t.Fatalf("got type %v, want object", got)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	if _, ok := properties["final"]; ok {
+		t.Error(`field tagged schema:"-" is exposed`)
+	}
+	if _, ok := properties["subtitles"]; ok {
+		t.Error(`field tagged schema:"-" is exposed`)
+	}
+	required := append([]string(nil), schema["required"].([]string)...)
+	sort.Strings(required)
+	if want := []string{"bgm", "shots", "style", "title"}; !reflect.DeepEqual(required, want) {
+		t.Errorf("got required %v, want %v", required, want)
+	}
+
+	shots := properties["shots"].(map[string]interface{})
+	if shots["type"] != "array" {
+		t.Fatalf("got shots type %v, want array", shots["type"])
+	}
+	shot := shots["items"].(map[string]interface{})
+	shotProperties := shot["properties"].(map[string]interface{})
+	for name, want := range map[string]string{
+		"duration":     "integer",
+		"source_start": "number",
+		"image_prompt": "string",
+		"motion":       "object",
+	} {
+		prop, ok := shotProperties[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("shot property %s is missing", name)
+			continue
+		}
+		if prop["type"] != want {
+			t.Errorf("shot property %s has type %v, want %s", name, prop["type"], want)
+		}
+	}
+	for _, hidden := range []string{"clip_path", "voice_path", "voice_length", "rendered_clip"} {
+		if _, ok := shotProperties[hidden]; ok {
+			t.Errorf("shot property %s is exposed", hidden)
+		}
+	}
+	shotRequired := append([]string(nil), shot["required"].([]string)...)
+	sort.Strings(shotRequired)
+	if want := []string{"duration", "image_prompt", "scene", "voiceover"}; !reflect.DeepEqual(shotRequired, want) {
+		t.Errorf("got required shot fields %v, want %v", shotRequired, want)
+	}
+}
+
+func TestGenerateScriptRepairsInvalidScript(t *testing.T) {
+	srv := useFakeOpenAI(t)
+	srv.EnqueueChat(
+		fakeopenai.ChatResponse{Content: `{"title":"Fake Video","shots":[{"scene":"Opening","voiceover":"Hello.","duration":0}]}`},
+		fakeopenai.ChatResponse{Content: "```json\n" + fakeopenai.DefaultScript + "\n```"},
+	)
+
+	script, err := GenerateScript(testContext(t), model.UserInput{Text: "A day in the city", SubtitleFormats: []string{"vtt"}})
+	if err != nil {
+		t.Fatalf("GenerateScript: %v", err)
+	}
+	if len(script.Shots) != 2 || script.Title != "Fake Video" {
+		t.Errorf("got script %+v, want the repaired default script", script)
+	}
+	if !reflect.DeepEqual(script.SubtitleFormats, []string{"vtt"}) {
+		t.Errorf("got subtitle formats %v, want [vtt]", script.SubtitleFormats)
+	}
+
+	chats := chatRequests(t, srv)
+	if len(chats) != 2 {
+		t.Fatalf("made %d chat completions, want 2", len(chats))
+	}
+	repair := chats[1]
+	if len(repair) != 4 || repair[2].Role != "assistant" || repair[3].Role != "user" {
+		t.Fatalf("repair request has messages %+v, want the invalid answer and the problems appended", repair)
+	}
+	for _, field := range []string{"shots[0].image_prompt", "shots[0].duration"} {
+		if !strings.Contains(repair[3].Content, field) {
+			t.Errorf("repair prompt does not mention %s:\n%s", field, repair[3].Content)
+		}
+	}
+}
+
+func TestGenerateScriptGivesUp(t *testing.T) {
+	srv := useFakeOpenAI(t)
+	for i := 0; i <= maxScriptRepairs; i++ {
+		srv.EnqueueChat(fakeopenai.ChatResponse{Content: `{"title":"","shots":[]}`})
+	}
+
+	if _, err := GenerateScript(testContext(t), model.UserInput{Text: "A day in the city"}); err == nil {
+		t.Fatal("GenerateScript accepted an invalid script")
+	}
+	if got := len(chatRequests(t, srv)); got != maxScriptRepairs+1 {
+		t.Errorf("made %d chat completions, want %d", got, maxScriptRepairs+1)
+	}
+}
+
+func TestGenerateScriptFallsBackWithoutStructuredOutputs(t *testing.T) {
+	srv := useFakeOpenAI(t)
+	srv.EnqueueChat(
+		fakeopenai.ChatResponse{Status: http.StatusBadRequest},
+		fakeopenai.ChatResponse{Status: http.StatusBadRequest},
+		fakeopenai.ChatResponse{Content: fakeopenai.DefaultScript},
+	)
+
+	script, err := GenerateScript(testContext(t), model.UserInput{Text: "A day in the city"})
+	if err != nil {
+		t.Fatalf("GenerateScript: %v", err)
+	}
+	if len(script.Shots) != 2 {
+		t.Errorf("got %d shots, want the 2 of the default script", len(script.Shots))
+	}
+
+	var formats []string
+	for _, req := range srv.Requests() {
+		var body OpenAIRequest
+		if err := json.Unmarshal(req.Body, &body); err != nil {
+			t.Fatalf("invalid chat request %s: %v", req.Body, err)
+		}
+		format := ""
+		if body.ResponseFormat != nil {
+			format = body.ResponseFormat.Type
+		}
+		formats = append(formats, format)
+	}
+	if want := []string{"json_schema", "json_object", ""}; !reflect.DeepEqual(formats, want) {
+		t.Errorf("got response formats %q, want %q", formats, want)
+	}
+}
+
+// chatRequests returns the messages of every chat completion the server received
+func chatRequests(t *testing.T, srv *fakeopenai.Server) [][]Message {
+	t.Helper()
+
+	var chats [][]Message
+	for _, req := range srv.Requests() {
+		if req.Path != "/v1/chat/completions" {
+			continue
+		}
+		var body OpenAIRequest
+		if err := json.Unmarshal(req.Body, &body); err != nil {
+			t.Fatalf("invalid chat request %s: %v", req.Body, err)
+		}
+		chats = append(chats, body.Messages)
+	}
+	return chats
+}
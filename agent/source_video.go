@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// sceneThreshold ffmpeg scene 滤镜的画面变化阈值，超过即视为切镜
+	sceneThreshold = 0.3
+	// minSceneLength 短于该时长（秒）的场景与后一个场景合并，避免闪切产生过碎的镜头
+	minSceneLength = 1.0
+)
+
+// SourceVideo 剪辑模式下用户上传的源视频及其场景划分
+type SourceVideo struct {
+	Path     string        `json:"path"`
+	Duration float64       `json:"duration"`
+	Width    int           `json:"width"`
+	Height   int           `json:"height"`
+	HasAudio bool          `json:"has_audio"`
+	Scenes   []SourceScene `json:"scenes"`
+}
+
+// SourceScene 源视频中两次切镜之间的一段画面
+type SourceScene struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// AnalyzeVideo 用 ffprobe 读取源视频信息，再用 scene 滤镜检测切镜。
+// URL 会先下载到本地，渲染时直接从本地文件截取片段
+func AnalyzeVideo(ctx context.Context, source string) (*SourceVideo, error) {
+	path := source
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		downloaded, err := downloadMedia(ctx, source, filepath.Join("uploads", "videos"), "source")
+		if err != nil {
+			return nil, fmt.Errorf("failed to download source video: %w", err)
+		}
+		path = downloaded
+	}
+
+	video, err := ProbeVideo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	cuts, err := detectSceneCuts(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	video.Scenes = buildScenes(cuts, video.Duration)
+	return video, nil
+}
+
+// ffprobeOutput ffprobe -print_format json 输出中用到的字段
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	} `json:"streams"`
+}
+
+// ProbeVideo 读取视频的时长、分辨率以及是否包含音轨
+func ProbeVideo(ctx context.Context, path string) (*SourceVideo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe error on %s: %v", path, err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output for %s: %w", path, err)
+	}
+
+	video := &SourceVideo{Path: path}
+	video.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			if video.Width == 0 {
+				video.Width, video.Height = stream.Width, stream.Height
+			}
+		case "audio":
+			video.HasAudio = true
+		}
+	}
+
+	if video.Width == 0 {
+		return nil, fmt.Errorf("%s has no video stream", path)
+	}
+	if video.Duration <= 0 {
+		return nil, fmt.Errorf("%s has no duration", path)
+	}
+	return video, nil
+}
+
+var ptsTimePattern = regexp.MustCompile(`pts_time:([0-9.]+)`)
+
+// detectSceneCuts 返回检测到切镜的时间点（秒），showinfo 会为 select 选中的每一帧输出一行
+func detectSceneCuts(ctx context.Context, path string) ([]float64, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner",
+		"-i", path,
+		"-filter:v", fmt.Sprintf("select='gt(scene,%g)',showinfo", sceneThreshold),
+		"-an",
+		"-f", "null",
+		"-")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("scene detection failed on %s: %v: %s", path, err, lastLine(output))
+	}
+
+	var cuts []float64
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.Contains(line, "Parsed_showinfo") {
+			continue
+		}
+		if match := ptsTimePattern.FindStringSubmatch(line); match != nil {
+			if t, err := strconv.ParseFloat(match[1], 64); err == nil {
+				cuts = append(cuts, t)
+			}
+		}
+	}
+	return cuts, nil
+}
+
+// buildScenes 把切镜时间点转换为连续的场景区间，过短的场景与后一个合并
+func buildScenes(cuts []float64, duration float64) []SourceScene {
+	var scenes []SourceScene
+	start := 0.0
+	for _, cut := range append(cuts, duration) {
+		if cut > duration {
+			cut = duration
+		}
+		if cut-start < minSceneLength {
+			continue
+		}
+		scenes = append(scenes, SourceScene{Start: start, End: cut})
+		start = cut
+	}
+
+	// 结尾剩下的零头并入最后一个场景
+	if start < duration {
+		if len(scenes) == 0 {
+			scenes = append(scenes, SourceScene{Start: start, End: duration})
+		} else {
+			scenes[len(scenes)-1].End = duration
+		}
+	}
+	return scenes
+}
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -26,17 +27,32 @@ func (a *ScriptGeneratorAgent) CanHandle(task string, context *OrchestrationCont
 	return context.UserInput.Text != "" && context.CurrentState["script"] == nil
 }
 
-func (a *ScriptGeneratorAgent) Execute(ctx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
-	log.Printf("🎬 ScriptGenerator: Creating script for task %s", ctx.TaskID)
+func (a *ScriptGeneratorAgent) Execute(ctx context.Context, octx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
+	log.Printf("🎬 ScriptGenerator: Creating script for task %s", octx.TaskID)
+
+	// 恢复的任务已有脚本时直接沿用，已生成的素材仍然对应原来的镜头
+	if script, ok := octx.Script(); ok {
+		return &AgentResult{
+			Success: true,
+			Data: map[string]interface{}{
+				"script": script,
+				"title":  script.Title,
+				"style":  script.Style,
+				"shots":  script.Shots,
+			},
+			Message: fmt.Sprintf("Reused existing script with %d shots", len(script.Shots)),
+		}, nil
+	}
 
 	// 调用原有的脚本生成逻辑
-	script, err := GenerateScript(ctx.UserInput)
+	script, err := GenerateScript(ctx, octx.UserInput)
 	if err != nil {
 		return &AgentResult{
 			Success: false,
 			Message: fmt.Sprintf("Script generation failed: %v", err),
 		}, err
 	}
+	octx.Checkpoints.SaveScript(script)
 
 	return &AgentResult{
 		Success: true,
@@ -46,9 +62,6 @@ func (a *ScriptGeneratorAgent) Execute(ctx *OrchestrationContext, params map[str
 			"style":  script.Style,
 			"shots":  script.Shots,
 		},
-		Resources: map[string]string{
-			"script_data": fmt.Sprintf("temp/script_%s.json", ctx.TaskID),
-		},
 		Message: fmt.Sprintf("Generated script with %d shots", len(script.Shots)),
 	}, nil
 }
@@ -77,30 +90,57 @@ func (a *ImageGeneratorAgent) CanHandle(task string, context *OrchestrationConte
 	return false
 }
 
-func (a *ImageGeneratorAgent) Execute(ctx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
-	log.Printf("🎨 ImageGenerator: Creating images for task %s", ctx.TaskID)
+func (a *ImageGeneratorAgent) Execute(ctx context.Context, octx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
+	log.Printf("🎨 ImageGenerator: Creating images for task %s", octx.TaskID)
 
-	script := ctx.CurrentState["script"]
-	if script == nil {
+	script, ok := octx.Script()
+	if !ok {
 		return &AgentResult{
 			Success: false,
 			Message: "No script available for image generation",
 		}, fmt.Errorf("missing script")
 	}
 
-	// 处理每个镜头的图像生成
+	// 可选参数：追加到每个提示词的画面风格
+	style, _ := params["style"].(string)
+
+	// 处理每个镜头的图像生成，已有图像的镜头跳过
 	generatedImages := make(map[string]string)
+	var failed []int
+	for i := range script.Shots {
+		shot := &script.Shots[i]
+		if shot.ClipPath != "" {
+			continue
+		}
 
-	// 模拟图像生成
-	imageCount := params["image_count"].(float64)
-	for i := 0; i < int(imageCount); i++ {
-		prompt := fmt.Sprintf("Image prompt for shot %d", i)
-		imagePath, err := GenerateImage(prompt)
+		// 脚本引用了用户提供的图像时直接使用，不再生成
+		imagePath, err := ReferenceImage(ctx, *shot, octx.UserInput.Images)
+		if err == nil && imagePath == "" {
+			prompt := shot.ImagePrompt
+			if style != "" {
+				prompt = fmt.Sprintf("%s, %s style", prompt, style)
+			}
+			imagePath, err = GenerateImage(ctx, prompt)
+		}
 		if err != nil {
-			log.Printf("Failed to generate image %d: %v", i, err)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Failed to generate image for shot %d: %v", i, err)
+			failed = append(failed, i)
 			continue
 		}
-		generatedImages[fmt.Sprintf("shot_%d", i)] = imagePath
+		shot.ClipPath = imagePath
+		shot.RenderedClip = ""
+		octx.Checkpoints.SaveShotImage(i, imagePath)
+		generatedImages[imageHandle(i)] = imagePath
+	}
+
+	if len(generatedImages) == 0 && len(failed) > 0 {
+		return &AgentResult{
+			Success: false,
+			Message: fmt.Sprintf("Image generation failed for all %d shots", len(failed)),
+		}, fmt.Errorf("image generation failed for all shots")
 	}
 
 	return &AgentResult{
@@ -108,6 +148,7 @@ func (a *ImageGeneratorAgent) Execute(ctx *OrchestrationContext, params map[stri
 		Data: map[string]interface{}{
 			"generated_images": generatedImages,
 			"image_count":      len(generatedImages),
+			"failed_shots":     failed,
 		},
 		Resources: generatedImages,
 		NextSteps: []string{"voice_generation"}, // 建议下一步
@@ -134,20 +175,58 @@ func (a *VoiceGeneratorAgent) CanHandle(task string, context *OrchestrationConte
 	return context.CurrentState["script"] != nil && context.Resources["final_audio"] == ""
 }
 
-func (a *VoiceGeneratorAgent) Execute(ctx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
-	log.Printf("🎙️ VoiceGenerator: Creating voiceovers for task %s", ctx.TaskID)
+func (a *VoiceGeneratorAgent) Execute(ctx context.Context, octx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
+	log.Printf("🎙️ VoiceGenerator: Creating voiceovers for task %s", octx.TaskID)
+
+	script, ok := octx.Script()
+	if !ok {
+		return &AgentResult{
+			Success: false,
+			Message: "No script available for voice generation",
+		}, fmt.Errorf("missing script")
+	}
+
+	// 用户提供了旁白录音时不再合成语音
+	if script.Narration != "" {
+		return &AgentResult{
+			Success:   true,
+			Data:      map[string]interface{}{"narration": script.Narration},
+			NextSteps: []string{"video_render"},
+			Message:   "Narration provided by the user, skipped voice generation",
+		}, nil
+	}
+
+	// 可选参数：TTS 音色
+	voice, _ := params["voice"].(string)
 
-	// 从参数或上下文获取文本
-	voiceTexts := params["voice_texts"].([]string)
 	generatedVoices := make(map[string]string)
+	var failed []int
+	for i := range script.Shots {
+		shot := &script.Shots[i]
+		if shot.VoicePath != "" || shot.Voiceover == "" {
+			continue
+		}
 
-	for i, text := range voiceTexts {
-		voicePath, err := GenerateVoiceover(text)
+		voicePath, err := GenerateVoiceoverWithOptions(ctx, shot.Voiceover, VoiceOptions{Voice: voice})
 		if err != nil {
-			log.Printf("Failed to generate voice %d: %v", i, err)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Failed to generate voice for shot %d: %v", i, err)
+			failed = append(failed, i)
 			continue
 		}
-		generatedVoices[fmt.Sprintf("voice_%d", i)] = voicePath
+		shot.VoicePath = voicePath
+		shot.RenderedClip = ""
+		octx.Checkpoints.SaveShotVoice(i, voicePath)
+		generatedVoices[voiceHandle(i)] = voicePath
+	}
+
+	if len(generatedVoices) == 0 && len(failed) > 0 {
+		return &AgentResult{
+			Success: false,
+			Message: fmt.Sprintf("Voice generation failed for all %d shots", len(failed)),
+		}, fmt.Errorf("voice generation failed for all shots")
 	}
 
 	return &AgentResult{
@@ -155,6 +234,7 @@ func (a *VoiceGeneratorAgent) Execute(ctx *OrchestrationContext, params map[stri
 		Data: map[string]interface{}{
 			"generated_voices": generatedVoices,
 			"voice_count":      len(generatedVoices),
+			"failed_shots":     failed,
 		},
 		Resources: generatedVoices,
 		NextSteps: []string{"video_render"},
@@ -182,30 +262,34 @@ func (a *VideoRenderAgent) CanHandle(task string, context *OrchestrationContext)
 	return len(context.Resources) > 0 && context.Resources["final_video"] == ""
 }
 
-func (a *VideoRenderAgent) Execute(ctx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
-	log.Printf("🎬 VideoRender: Rendering final video for task %s", ctx.TaskID)
+func (a *VideoRenderAgent) Execute(ctx context.Context, octx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
+	log.Printf("🎬 VideoRender: Rendering final video for task %s", octx.TaskID)
 
-	// 从上下文获取脚本和资源
-	scriptData := ctx.CurrentState["script"]
-	if scriptData == nil {
+	// 从上下文获取脚本，镜头中已写回图像和语音路径
+	script, ok := octx.Script()
+	if !ok {
 		return &AgentResult{
 			Success: false,
 			Message: "No script data available for rendering",
 		}, fmt.Errorf("missing script data")
 	}
 
-	// 模拟视频渲染过程
-	time.Sleep(2 * time.Second) // 模拟渲染时间
-
-	finalVideoPath := fmt.Sprintf("uploads/videos/final_%s.mp4", ctx.TaskID)
+	startTime := time.Now()
+	finalVideoPath, err := RenderVideoWithOptions(ctx, script, renderOptionsFor(octx.TaskID, octx.Checkpoints))
+	if err != nil {
+		return &AgentResult{
+			Success: false,
+			Message: fmt.Sprintf("Video rendering failed: %v", err),
+		}, err
+	}
+	script.Final = finalVideoPath
 
 	return &AgentResult{
 		Success: true,
 		Data: map[string]interface{}{
 			"video_path":  finalVideoPath,
-			"duration":    120, // 假设2分钟
-			"resolution":  "1920x1080",
-			"render_time": 2000,
+			"shot_count":  len(script.Shots),
+			"render_time": time.Since(startTime).Milliseconds(),
 		},
 		Resources: map[string]string{
 			"final_video": finalVideoPath,
@@ -234,8 +318,8 @@ func (a *AnalysisAgent) CanHandle(task string, context *OrchestrationContext) bo
 	return context.UserInput.Text != "" || len(context.Resources) > 0
 }
 
-func (a *AnalysisAgent) Execute(ctx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
-	log.Printf("🔍 Analysis: Analyzing content for task %s", ctx.TaskID)
+func (a *AnalysisAgent) Execute(ctx context.Context, octx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
+	log.Printf("🔍 Analysis: Analyzing content for task %s", octx.TaskID)
 
 	// 分析用户输入和当前状态
 	analysis := map[string]interface{}{
@@ -277,8 +361,8 @@ func (a *QualityCheckAgent) CanHandle(task string, context *OrchestrationContext
 	return context.Resources["final_video"] != ""
 }
 
-func (a *QualityCheckAgent) Execute(ctx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
-	log.Printf("✅ QualityCheck: Validating quality for task %s", ctx.TaskID)
+func (a *QualityCheckAgent) Execute(ctx context.Context, octx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
+	log.Printf("✅ QualityCheck: Validating quality for task %s", octx.TaskID)
 
 	// 模拟质量检查
 	qualityScore := 0.92
@@ -332,8 +416,8 @@ func (a *OptimizationAgent) CanHandle(task string, context *OrchestrationContext
 	return true
 }
 
-func (a *OptimizationAgent) Execute(ctx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
-	log.Printf("⚡ Optimization: Optimizing content for task %s", ctx.TaskID)
+func (a *OptimizationAgent) Execute(ctx context.Context, octx *OrchestrationContext, params map[string]interface{}) (*AgentResult, error) {
+	log.Printf("⚡ Optimization: Optimizing content for task %s", octx.TaskID)
 
 	// 根据分析结果进行优化
 	optimizations := []string{
@@ -351,7 +435,7 @@ func (a *OptimizationAgent) Execute(ctx *OrchestrationContext, params map[string
 			"new_quality_score":     0.95,
 		},
 		Resources: map[string]string{
-			"optimized_video": fmt.Sprintf("uploads/videos/optimized_%s.mp4", ctx.TaskID),
+			"optimized_video": fmt.Sprintf("uploads/videos/optimized_%s.mp4", octx.TaskID),
 		},
 		Message: "Content optimization completed successfully",
 	}, nil
@@ -1,50 +1,232 @@
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
+	"video-agent-go/config"
 	"video-agent-go/model"
+	"video-agent-go/storage"
+	"video-agent-go/subtitle"
 )
 
-func GenerateSubtitle(script model.ScriptOutput) (string, error) {
-	var srtContent strings.Builder
+// errNoSubtitles is returned when no shot has any text to show
+var errNoSubtitles = errors.New("script has no subtitle text")
 
-	currentTime := 0
+// BuildCues turns the script into subtitle cues. Transitions overlap
+// neighbouring shots, so the times come from the timeline. Long text is split
+// at sentence and clause boundaries and spread over the measured voiceover;
+// the last cue stays up until the next shot starts.
+func BuildCues(script model.ScriptOutput) []subtitle.Cue {
+	timings, _ := BuildTimeline(script)
+	maxChars := config.AppConfig.Subtitle.MaxCueChars
+	var cues []subtitle.Cue
 	for i, shot := range script.Shots {
-		start := formatTime(currentTime)
-		end := formatTime(currentTime + shot.Duration)
+		text := subtitleText(shot)
+		if text == "" {
+			continue
+		}
 
-		srtContent.WriteString(fmt.Sprintf("%d\n", i+1))
-		srtContent.WriteString(fmt.Sprintf("%s --> %s\n", start, end))
-		srtContent.WriteString(fmt.Sprintf("%s\n\n", shot.Subtitle))
+		end := timings[i].End
+		if i+1 < len(timings) {
+			end = math.Min(end, timings[i+1].Start)
+		}
+		spoken := end
+		if shot.VoiceLength > 0 {
+			spoken = math.Min(timings[i].Start+shot.VoiceLength, end)
+		}
 
-		currentTime += shot.Duration
+		shotCues := subtitle.Distribute(seconds(timings[i].Start), seconds(spoken), subtitle.Split(text, maxChars))
+		if n := len(shotCues); n > 0 {
+			shotCues[n-1].End = seconds(end)
+		}
+		cues = append(cues, shotCues...)
 	}
+	return cues
+}
 
-	// Save subtitle file
-	filename := fmt.Sprintf("subtitle_%d.srt", time.Now().UnixNano())
-	filePath := filepath.Join("uploads", "subtitles", filename)
-
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+// GenerateSubtitle writes the script's subtitles as SRT
+func GenerateSubtitle(script model.ScriptOutput) (string, error) {
+	paths, err := GenerateSubtitles(script, []subtitle.Format{subtitle.SRT})
+	if err != nil {
 		return "", err
 	}
+	return paths[subtitle.SRT], nil
+}
 
-	// Write subtitle file
-	if err := os.WriteFile(filePath, []byte(srtContent.String()), 0644); err != nil {
-		return "", err
+// GenerateSubtitles writes the script's subtitles once per format under
+// uploads/subtitles. All formats share a base name and the configured style.
+func GenerateSubtitles(script model.ScriptOutput, formats []subtitle.Format) (map[subtitle.Format]string, error) {
+	cues := BuildCues(script)
+	if len(cues) == 0 {
+		return nil, errNoSubtitles
+	}
+	track := subtitle.Track{Cues: cues, Style: subtitleStyle(config.AppConfig.Subtitle)}
+
+	dir := filepath.Join("uploads", "subtitles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	base := fmt.Sprintf("subtitle_%d", time.Now().UnixNano())
+	paths := make(map[subtitle.Format]string, len(formats))
+	for _, format := range formats {
+		data, err := subtitle.Encode(format, track)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, base+format.Extension())
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, err
+		}
+		paths[format] = path
+	}
+	return paths, nil
+}
+
+// subtitleFormats parses the formats requested for the script, SRT by default
+func subtitleFormats(names []string) []subtitle.Format {
+	var formats []subtitle.Format
+	seen := make(map[subtitle.Format]bool)
+	for _, name := range names {
+		format, err := subtitle.ParseFormat(name)
+		if err != nil {
+			log.Printf("Skipping subtitle format: %v", err)
+			continue
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		formats = []subtitle.Format{subtitle.SRT}
+	}
+	return formats
+}
+
+func subtitleStyle(cfg config.SubtitleConfig) subtitle.Style {
+	return subtitle.Style{
+		Font:     cfg.Font,
+		FontSize: cfg.FontSize,
+		Outline:  cfg.Outline,
+		Position: cfg.Position,
+		Margin:   cfg.Margin,
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
+
+// subtitleText is the caption of a shot, falling back to its voiceover
+func subtitleText(shot model.Shot) string {
+	if text := strings.TrimSpace(shot.Subtitle); text != "" {
+		return text
+	}
+	return strings.TrimSpace(shot.Voiceover)
+}
+
+// Subtitle modes, see config.SubtitleConfig
+const (
+	SubtitleBurn = "burn"
+	SubtitleSoft = "soft"
+	SubtitleOff  = "off"
+)
+
+// addSubtitles writes the subtitle files requested by the script and, unless
+// subtitles are off, burns them into the video or muxes them as a mov_text
+// track. It returns the resulting video and the subtitle files by format; the
+// video is returned unchanged when there is no text.
+func addSubtitles(ctx context.Context, videoPath string, script model.ScriptOutput, tempDir string) (string, map[string]string, error) {
+	cfg := config.AppConfig.Subtitle
+
+	paths, err := GenerateSubtitles(script, subtitleFormats(script.SubtitleFormats))
+	if errors.Is(err, errNoSubtitles) {
+		return videoPath, nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate subtitles: %w", err)
+	}
+
+	published := make(map[string]string, len(paths))
+	for format, path := range paths {
+		published[string(format)] = publishSubtitles(path)
+	}
+	if cfg.Mode == SubtitleOff {
+		return videoPath, published, nil
 	}
 
-	return filePath, nil
+	// Burning renders the styled ASS file; mov_text has no styling, so SRT is enough
+	format := subtitle.ASS
+	if cfg.Mode == SubtitleSoft {
+		format = subtitle.SRT
+	}
+	track := subtitle.Track{Cues: BuildCues(script), Style: subtitleStyle(cfg)}
+	data, err := subtitle.Encode(format, track)
+	if err != nil {
+		return "", nil, err
+	}
+	embedPath := filepath.Join(tempDir, "subtitles"+format.Extension())
+	if err := os.WriteFile(embedPath, data, 0644); err != nil {
+		return "", nil, err
+	}
+
+	outputPath := filepath.Join(tempDir, "subtitled.mp4")
+	var args []string
+	if cfg.Mode == SubtitleSoft {
+		args = []string{
+			"-i", videoPath,
+			"-i", embedPath,
+			"-map", "0",
+			"-map", "1:0",
+			"-c", "copy",
+			"-c:s", "mov_text",
+			"-y", outputPath,
+		}
+	} else {
+		args = []string{
+			"-i", videoPath,
+			"-vf", fmt.Sprintf("subtitles=filename='%s'", escapeFilterValue(embedPath)),
+			"-c:v", "libx264",
+			"-pix_fmt", "yuv420p",
+			"-c:a", "copy",
+			"-y", outputPath,
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, fmt.Errorf("failed to add subtitles: %v: %s", err, lastLine(output))
+	}
+
+	return outputPath, published, nil
 }
 
-func formatTime(seconds int) string {
-	hours := seconds / 3600
-	minutes := (seconds % 3600) / 60
-	secs := seconds % 60
+// escapeFilterValue escapes a value quoted inside an ffmpeg filter argument
+func escapeFilterValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `'\''`, `:`, `\:`).Replace(value)
+}
 
-	return fmt.Sprintf("%02d:%02d:%02d,000", hours, minutes, secs)
+// publishSubtitles uploads the subtitle file when cloud storage is configured
+func publishSubtitles(subtitlePath string) string {
+	if config.AppConfig.Storage.Type == "cloud" {
+		cloudPath, err := storage.UploadToCloud(subtitlePath, "subtitles/"+filepath.Base(subtitlePath))
+		if err != nil {
+			return subtitlePath // fallback to local path
+		}
+		return cloudPath
+	}
+	return subtitlePath
 }
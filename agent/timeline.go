@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"math"
+	"video-agent-go/config"
+	"video-agent-go/model"
+)
+
+// defaultTransitionDuration 转场没有指定时长时使用的时长（秒）
+const defaultTransitionDuration = 0.5
+
+// ShotTiming 镜头在成片时间轴上的起止时间（秒）
+type ShotTiming struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// shotLength 镜头片段的时长：剪辑镜头取源视频区间；有配音的镜头取实测的配音时长加留白，
+// 其余取脚本时长。片段、字幕和总时长都由它计算，保证三者一致
+func shotLength(shot model.Shot) float64 {
+	if shot.HasSource() {
+		return shot.SourceEnd - shot.SourceStart
+	}
+	if shot.VoiceLength > 0 {
+		return shot.VoiceLength + config.AppConfig.Subtitle.VoicePadding.Seconds()
+	}
+	if shot.Duration <= 0 {
+		return 5 // same default as createVideoClip
+	}
+	return float64(shot.Duration)
+}
+
+// transitionInto 返回切入第 i 个镜头的转场：镜头自己的设置优先，其次是脚本的默认转场，都没有时为硬切
+func transitionInto(script model.ScriptOutput, i int) model.Transition {
+	if i <= 0 || i >= len(script.Shots) {
+		return model.Transition{Type: model.TransitionCut}
+	}
+
+	transition := model.Transition{Type: model.TransitionCut}
+	if script.Shots[i].Transition != nil {
+		transition = *script.Shots[i].Transition
+	} else if script.Transition != nil {
+		transition = *script.Transition
+	}
+	if transition.Type == model.TransitionCut || transition.Type == "" {
+		return model.Transition{Type: model.TransitionCut}
+	}
+	if transition.Duration <= 0 {
+		transition.Duration = defaultTransitionDuration
+	}
+	return transition
+}
+
+// overlapDuration 转场实际的重叠时长。每个镜头可能同时与前后镜头重叠，
+// 因此不超过相邻两个镜头中较短者的一半
+func overlapDuration(transition model.Transition, prev, next float64) float64 {
+	if transition.Type == model.TransitionCut {
+		return 0
+	}
+	return math.Min(transition.Duration, math.Min(prev, next)/2)
+}
+
+// BuildTimeline 计算每个镜头在成片中的起止时间及总时长，转场重叠的部分只计算一次
+func BuildTimeline(script model.ScriptOutput) ([]ShotTiming, float64) {
+	timings := make([]ShotTiming, len(script.Shots))
+	position := 0.0
+	for i, shot := range script.Shots {
+		length := shotLength(shot)
+		if i > 0 {
+			position -= overlapDuration(transitionInto(script, i), shotLength(script.Shots[i-1]), length)
+		}
+		timings[i] = ShotTiming{Start: position, End: position + length}
+		position += length
+	}
+	return timings, position
+}
+
+// measureVoices 用 ffprobe 测量尚未测量过的配音时长，并把镜头时长更新为配音时长加留白。
+// 测量失败时保留脚本给出的时长
+func measureVoices(ctx context.Context, script *model.ScriptOutput) error {
+	for i := range script.Shots {
+		shot := &script.Shots[i]
+		if shot.VoicePath == "" || shot.VoiceLength > 0 {
+			continue
+		}
+
+		length, err := ProbeDuration(ctx, shot.VoicePath)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Failed to measure voice of shot %d, keeping %ds: %v", i, shot.Duration, err)
+			continue
+		}
+		shot.VoiceLength = length
+		if !shot.HasSource() {
+			shot.Duration = int(math.Ceil(shotLength(*shot)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"video-agent-go/model"
+)
+
+// Validate 按工具声明的参数校验LLM给出的参数：填充默认值、检查必填项、类型、枚举和数值范围
+// 返回补全默认值后的参数副本
+func (p ToolParameters) Validate(args map[string]interface{}) (map[string]interface{}, model.ValidationErrors) {
+	validated := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		if value != nil {
+			validated[name] = value
+		}
+	}
+
+	for name, prop := range p.Properties {
+		if _, ok := validated[name]; !ok && prop.Default != nil {
+			validated[name] = prop.Default
+		}
+	}
+
+	var errs model.ValidationErrors
+	for _, name := range p.Required {
+		if _, ok := validated[name]; !ok {
+			errs = append(errs, model.FieldError{Field: name, Message: "is required"})
+		}
+	}
+
+	names := make([]string, 0, len(validated))
+	for name := range validated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop, declared := p.Properties[name]
+		if !declared {
+			continue
+		}
+		value := validated[name]
+		if !matchesJSONType(prop.Type, value) {
+			errs = append(errs, model.FieldError{
+				Field:   name,
+				Message: fmt.Sprintf("must be of type %s, got %s", prop.Type, jsonTypeOf(value)),
+			})
+			continue
+		}
+		if len(prop.Enum) > 0 && !containsString(prop.Enum, value) {
+			errs = append(errs, model.FieldError{
+				Field:   name,
+				Message: fmt.Sprintf("must be one of %v, got %v", prop.Enum, value),
+			})
+		}
+		if prop.Minimum != nil && toFloat(value) < *prop.Minimum {
+			errs = append(errs, model.FieldError{
+				Field:   name,
+				Message: fmt.Sprintf("must be at least %g, got %v", *prop.Minimum, value),
+			})
+		}
+		if prop.Maximum != nil && toFloat(value) > *prop.Maximum {
+			errs = append(errs, model.FieldError{
+				Field:   name,
+				Message: fmt.Sprintf("must be at most %g, got %v", *prop.Maximum, value),
+			})
+		}
+	}
+
+	return validated, errs
+}
+
+// decodeToolArgs 将校验后的参数解码到工具自己的参数结构体
+func decodeToolArgs(args map[string]interface{}, target interface{}) model.ValidationErrors {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return model.ValidationErrors{{Field: "(arguments)", Message: err.Error()}}
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return model.ValidationErrors{{
+				Field:   typeErr.Field,
+				Message: fmt.Sprintf("cannot use %s as %s", typeErr.Value, typeErr.Type),
+			}}
+		}
+		return model.ValidationErrors{{Field: "(arguments)", Message: err.Error()}}
+	}
+
+	return nil
+}
+
+func matchesJSONType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		return isNumber(value)
+	case "integer":
+		if !isNumber(value) {
+			return false
+		}
+		f, ok := value.(float64)
+		return !ok || f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	default:
+		return true
+	}
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case float64, float32, int, int64, int32:
+		return true
+	default:
+		return false
+	}
+}
+
+// toFloat 返回数值参数的值，非数值返回 NaN，不会触发范围检查
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	default:
+		return math.NaN()
+	}
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		if isNumber(value) {
+			return "number"
+		}
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func containsString(options []string, value interface{}) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	for _, option := range options {
+		if option == s {
+			return true
+		}
+	}
+	return false
+}
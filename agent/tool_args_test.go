@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"video-agent-go/model"
+)
+
+func TestToolParametersMinimum(t *testing.T) {
+	params := (&ImageGenerationTool{}).GetParameters()
+
+	tests := []struct {
+		name   string
+		args   map[string]interface{}
+		fields []string
+	}{
+		{"default start", map[string]interface{}{"prompts": []interface{}{"a"}}, nil},
+		{"zero start", map[string]interface{}{"prompts": []interface{}{"a"}, "start_shot": 0.0}, nil},
+		{"positive start", map[string]interface{}{"prompts": []interface{}{"a"}, "start_shot": 2.0}, nil},
+		{"negative start", map[string]interface{}{"prompts": []interface{}{"a"}, "start_shot": -1.0}, []string{"start_shot"}},
+		{"fractional start", map[string]interface{}{"prompts": []interface{}{"a"}, "start_shot": 0.5}, []string{"start_shot"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := params.Validate(tt.args)
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if len(fields) != len(tt.fields) || (len(fields) > 0 && fields[0] != tt.fields[0]) {
+				t.Errorf("got errors %v, want errors on %v", errs, tt.fields)
+			}
+		})
+	}
+}
+
+func TestToolParametersRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		params ToolParameters
+		args   map[string]interface{}
+		fields []string
+	}{
+		{"default speed", (&VoiceGenerationTool{}).GetParameters(), map[string]interface{}{"text": "hi"}, nil},
+		{"slowest speed", (&VoiceGenerationTool{}).GetParameters(), map[string]interface{}{"text": "hi", "speed": 0.5}, nil},
+		{"too slow", (&VoiceGenerationTool{}).GetParameters(), map[string]interface{}{"text": "hi", "speed": 0.25}, []string{"speed"}},
+		{"too fast", (&VoiceGenerationTool{}).GetParameters(), map[string]interface{}{"text": "hi", "speed": 3.0}, []string{"speed"}},
+		{"whole duration", (&ScriptGenerationTool{}).GetParameters(), map[string]interface{}{"content_type": "news", "target_audience": "all", "duration": 60.0}, nil},
+		{"fractional duration", (&ScriptGenerationTool{}).GetParameters(), map[string]interface{}{"content_type": "news", "target_audience": "all", "duration": 60.5}, []string{"duration"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := tt.params.Validate(tt.args)
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if len(fields) != len(tt.fields) || (len(fields) > 0 && fields[0] != tt.fields[0]) {
+				t.Errorf("got errors %v, want errors on %v", errs, tt.fields)
+			}
+		})
+	}
+}
+
+func TestImageToolIgnoresShotsOutsideScript(t *testing.T) {
+	useFakeOpenAI(t)
+
+	script := &model.ScriptOutput{Shots: []model.Shot{{ImagePrompt: "A skyline"}}}
+	octx := &ToolOrchestrationContext{
+		CurrentState: map[string]interface{}{"script": script},
+		Resources:    make(map[string]string),
+		Checkpoints:  noopCheckpointer{},
+	}
+
+	// Execute is only reached with validated arguments, but must not index
+	// the script with whatever shot it is given
+	result, err := (&ImageGenerationTool{}).Execute(testContext(t), octx, &ImageToolArgs{
+		Prompts:   []string{"before", "first", "after"},
+		StartShot: -1,
+	})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if images := result.Data.(map[string]interface{})["images"].([]map[string]interface{}); len(images) != 3 {
+		t.Errorf("generated %d images, want 3", len(images))
+	}
+	if script.Shots[0].ClipPath == "" {
+		t.Error("shot 0 did not get the image of its prompt")
+	}
+}
+
+func TestRenderToolRejectsMissingImages(t *testing.T) {
+	script := &model.ScriptOutput{Shots: []model.Shot{{ImagePrompt: "A"}, {ImagePrompt: "B"}, {ImagePrompt: "C"}}}
+	octx := &ToolOrchestrationContext{
+		CurrentState: map[string]interface{}{"script": script},
+		Resources:    map[string]string{imageHandle(0): "image_0.png"},
+		Checkpoints:  noopCheckpointer{},
+	}
+
+	_, err := (&VideoRenderTool{}).Execute(testContext(t), octx, &RenderToolArgs{})
+	if err == nil {
+		t.Fatal("Execute rendered a script with shots missing their images")
+	}
+	for _, want := range []string{"[1 2]", "start_shot 1"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
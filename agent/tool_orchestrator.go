@@ -1,22 +1,36 @@
 package agent
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"strings"
 	"time"
-	"video-agent-go/config"
 	"video-agent-go/model"
 )
 
 // ToolBasedOrchestrator 基于工具的LLM编排器
 type ToolBasedOrchestrator struct {
+	llm           LLMProvider
 	toolRegistry  *ToolRegistry
 	context       *ToolOrchestrationContext
 	maxIterations int
+
+	// Checkpoints 保存各阶段产物；Resume 为上次失败前已生成的脚本和素材
+	Checkpoints Checkpointer
+	Resume      *model.ScriptOutput
+	// Recorder 持久化每次工具调用
+	Recorder ExecutionRecorder
+	// ReferenceImages 用户提供的图像，脚本中的镜头可以通过 image_ref 引用
+	ReferenceImages []string
+	// SourceVideo 用户上传的源视频，设置后以剪辑模式生成脚本
+	SourceVideo string
+	// UserAudio 用户提供的音频，AudioRole 决定作为旁白还是背景音乐
+	UserAudio string
+	AudioRole model.AudioRole
+	// SubtitleFormats 需要输出的字幕格式
+	SubtitleFormats []string
 }
 
 // ToolOrchestrationContext 工具编排上下文
@@ -26,6 +40,18 @@ type ToolOrchestrationContext struct {
 	CurrentState map[string]interface{} `json:"current_state"`
 	ToolCalls    []CompletedToolCall    `json:"tool_calls"`
 	Resources    map[string]string      `json:"resources"`
+	Checkpoints  Checkpointer           `json:"-"`
+	// Resumed 表示从失败的任务恢复，工具会复用已有的脚本和素材
+	Resumed bool `json:"resumed"`
+	// ReferenceImages 用户提供的图像，引用了图像的镜头不再生成
+	ReferenceImages []string `json:"reference_images,omitempty"`
+	// SourceVideo 剪辑模式的源视频，镜头直接截取其中的片段
+	SourceVideo string `json:"source_video,omitempty"`
+	// UserAudio 用户提供的旁白或背景音乐
+	UserAudio string          `json:"user_audio,omitempty"`
+	AudioRole model.AudioRole `json:"audio_role,omitempty"`
+	// SubtitleFormats 渲染时输出的字幕格式
+	SubtitleFormats []string `json:"subtitle_formats,omitempty"`
 }
 
 // CompletedToolCall 完成的工具调用记录
@@ -52,33 +78,58 @@ type ChatMessage struct {
 	Name       string     `json:"name,omitempty"`
 }
 
+// Script 返回 generate_script 工具生成的脚本，后续工具会把素材路径写回其中
+func (c *ToolOrchestrationContext) Script() (*model.ScriptOutput, bool) {
+	script, ok := c.CurrentState["script"].(*model.ScriptOutput)
+	return script, ok && script != nil
+}
+
 // NewToolBasedOrchestrator 创建基于工具的编排器
 func NewToolBasedOrchestrator() *ToolBasedOrchestrator {
-	registry := NewToolRegistry()
-
-	// 注册所有可用工具
-	registry.RegisterTool(&ContentAnalysisTool{})
-	registry.RegisterTool(&ScriptGenerationTool{})
-	registry.RegisterTool(&ImageGenerationTool{})
-	registry.RegisterTool(&VoiceGenerationTool{})
-	registry.RegisterTool(&QualityCheckTool{})
-	registry.RegisterTool(&VideoRenderTool{})
-
 	return &ToolBasedOrchestrator{
-		toolRegistry:  registry,
+		llm:           GetLLMProvider(),
+		toolRegistry:  newDefaultToolRegistry(),
 		maxIterations: 10, // 防止无限循环
 	}
 }
 
 // ProcessTask 处理任务 - 基于工具的智能编排
-func (o *ToolBasedOrchestrator) ProcessTask(taskID string, userRequest string) (*model.ScriptOutput, error) {
+func (o *ToolBasedOrchestrator) ProcessTask(ctx context.Context, taskID string, userRequest string) (*model.ScriptOutput, error) {
 	// 初始化上下文
 	o.context = &ToolOrchestrationContext{
-		TaskID:       taskID,
-		UserRequest:  userRequest,
-		CurrentState: make(map[string]interface{}),
-		ToolCalls:    make([]CompletedToolCall, 0),
-		Resources:    make(map[string]string),
+		TaskID:          taskID,
+		UserRequest:     userRequest,
+		CurrentState:    make(map[string]interface{}),
+		ToolCalls:       make([]CompletedToolCall, 0),
+		Resources:       make(map[string]string),
+		Checkpoints:     checkpointerOrNoop(o.Checkpoints),
+		ReferenceImages: o.ReferenceImages,
+		SourceVideo:     o.SourceVideo,
+		UserAudio:       o.UserAudio,
+		AudioRole:       o.AudioRole,
+		SubtitleFormats: o.SubtitleFormats,
+	}
+
+	userMessage := fmt.Sprintf("Please help me create a video based on this request: \"%s\"", userRequest)
+	if len(o.ReferenceImages) > 0 {
+		userMessage += fmt.Sprintf("\n\nThe user provided %d reference images. The script assigns them to shots via image_ref; "+
+			"generate_images uses the provided image for those shots instead of generating one.", len(o.ReferenceImages))
+	}
+	if o.SourceVideo != "" {
+		userMessage += "\n\nThe user provided a video to edit. generate_script cuts every shot from it, " +
+			"so skip generate_images and only generate voice before rendering."
+	}
+	if o.AudioRole == model.AudioNarration {
+		userMessage += "\n\nThe user provided the narration recording, so skip generate_voice."
+	}
+
+	// 从上次失败的位置继续：告诉LLM哪些素材已经存在，只补齐缺失的部分
+	if o.Resume != nil {
+		o.context.CurrentState["script"] = o.Resume
+		o.context.Resources = resumeResources(o.Resume)
+		o.context.Resumed = true
+		userMessage += "\n\n" + buildResumeNote(o.Resume)
+		log.Printf("♻️ Resuming task %s with %d checkpointed resources", taskID, len(o.context.Resources))
 	}
 
 	log.Printf("🚀 Starting tool-based orchestration for task: %s", taskID)
@@ -91,21 +142,25 @@ func (o *ToolBasedOrchestrator) ProcessTask(taskID string, userRequest string) (
 		},
 		{
 			Role:    "user",
-			Content: fmt.Sprintf("Please help me create a video based on this request: \"%s\"", userRequest),
+			Content: userMessage,
 		},
 	}
 
 	// 与LLM进行多轮对话，直到任务完成
 	for iteration := 0; iteration < o.maxIterations; iteration++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		log.Printf("🔄 Iteration %d: Consulting LLM for next action", iteration+1)
 
 		// 调用LLM获取下一步动作
-		response, err := o.callLLMWithTools(messages)
+		response, err := o.callLLMWithTools(ctx, messages)
 		if err != nil {
 			return nil, fmt.Errorf("LLM call failed: %v", err)
 		}
 
-		// 将LLM响应添加到消息历史
+		// 将LLM响应添加到消息历史，参数以规范的JSON字符串回传
+		response.ToolCalls = normalizeToolCalls(response.ToolCalls)
 		messages = append(messages, ChatMessage{
 			Role:      "assistant",
 			Content:   response.Content,
@@ -121,13 +176,23 @@ func (o *ToolBasedOrchestrator) ProcessTask(taskID string, userRequest string) (
 
 		// 执行所有工具调用
 		for _, toolCall := range response.ToolCalls {
-			result, err := o.executeToolCall(toolCall)
+			result, err := o.executeToolCall(ctx, toolCall)
 			if err != nil {
+				// 任务被取消时直接结束，不再把错误交给LLM
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
 				log.Printf("❌ Tool call failed: %v", err)
-				// 将错误信息添加到消息历史
+				// 将错误信息添加到消息历史，带结构化细节时原样交给LLM修正
+				content := fmt.Sprintf("Tool execution failed: %v", err)
+				if result != nil && result.Data != nil {
+					if resultJSON, err := json.Marshal(result); err == nil {
+						content = string(resultJSON)
+					}
+				}
 				messages = append(messages, ChatMessage{
 					Role:       "tool",
-					Content:    fmt.Sprintf("Tool execution failed: %v", err),
+					Content:    content,
 					ToolCallID: toolCall.ID,
 					Name:       toolCall.Function.Name,
 				})
@@ -148,6 +213,10 @@ func (o *ToolBasedOrchestrator) ProcessTask(taskID string, userRequest string) (
 		}
 	}
 
+	if o.context.Resources["final_video"] == "" {
+		return nil, fmt.Errorf("orchestration ended without rendering a video")
+	}
+
 	// 构建最终结果
 	return o.buildFinalResult(), nil
 }
@@ -184,71 +253,24 @@ You must use tools to accomplish tasks. Do not try to generate content directly.
 func (o *ToolBasedOrchestrator) buildToolsDescription() string {
 	var descriptions []string
 
-	for _, tool := range o.toolRegistry.GetAllTools() {
+	for _, tool := range o.toolRegistry.sortedTools() {
 		description := fmt.Sprintf("- %s: %s", tool.GetName(), tool.GetDescription())
 		descriptions = append(descriptions, description)
 	}
 
-	return fmt.Sprintf("%s", descriptions)
+	return strings.Join(descriptions, "\n")
 }
 
 // callLLMWithTools 调用LLM并支持工具调用
-func (o *ToolBasedOrchestrator) callLLMWithTools(messages []ChatMessage) (*LLMResponse, error) {
-	// 构建OpenAI API请求
-	reqBody := map[string]interface{}{
-		"model":       "gpt-4-turbo-preview",
-		"messages":    messages,
-		"tools":       o.toolRegistry.GetToolsSchema(),
-		"tool_choice": "auto", // 让LLM自动决定是否调用工具
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.AppConfig.API.OpenAIKey)
-
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var openAIResp struct {
-		Choices []struct {
-			Message LLMResponse `json:"message"`
-		} `json:"choices"`
-	}
-
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return nil, err
-	}
-
-	if len(openAIResp.Choices) == 0 {
-		return nil, fmt.Errorf("no response from OpenAI")
-	}
-
-	return &openAIResp.Choices[0].Message, nil
+func (o *ToolBasedOrchestrator) callLLMWithTools(ctx context.Context, messages []ChatMessage) (*LLMResponse, error) {
+	return o.llm.ChatWithTools(ctx, StageToolOrchestrator, messages, o.toolRegistry.GetToolsSchema())
 }
 
 // executeToolCall 执行工具调用
-func (o *ToolBasedOrchestrator) executeToolCall(toolCall ToolCall) (*ToolResult, error) {
+func (o *ToolBasedOrchestrator) executeToolCall(ctx context.Context, toolCall ToolCall) (*ToolResult, error) {
 	startTime := time.Now()
 
-	result, err := o.toolRegistry.ExecuteToolCall(toolCall)
+	result, err := o.toolRegistry.ExecuteToolCall(ctx, o.context, toolCall)
 
 	duration := time.Since(startTime).Milliseconds()
 
@@ -261,6 +283,20 @@ func (o *ToolBasedOrchestrator) executeToolCall(toolCall ToolCall) (*ToolResult,
 	}
 
 	o.context.ToolCalls = append(o.context.ToolCalls, completedCall)
+	recorderOrNoop(o.Recorder).RecordExecution(toolCallRecord(o.context.TaskID, completedCall, err, startTime))
+
+	message := fmt.Sprintf("Tool %s succeeded", toolCall.Function.Name)
+	if err != nil {
+		message = fmt.Sprintf("Tool %s failed: %v", toolCall.Function.Name, err)
+	} else if result != nil && !result.Success {
+		message = fmt.Sprintf("Tool %s failed: %s", toolCall.Function.Name, result.Error)
+	}
+	observerManager.Publish(model.TaskEvent{
+		TaskID:  o.context.TaskID,
+		Type:    model.EventToolCall,
+		Message: message,
+		Data:    completedCall,
+	})
 
 	return result, err
 }
@@ -272,30 +308,12 @@ func (o *ToolBasedOrchestrator) updateContextFromToolResult(toolName string, res
 	}
 
 	// 根据工具类型更新不同的状态
+	// 生成类工具直接把脚本和素材句柄写入上下文，这里只记录分析类结果
 	switch toolName {
 	case "analyze_content":
 		if analysis, ok := result.Data.(map[string]interface{}); ok {
 			o.context.CurrentState["content_analysis"] = analysis
 		}
-	case "generate_script":
-		if script, ok := result.Data.(map[string]interface{}); ok {
-			o.context.CurrentState["script"] = script
-		}
-	case "generate_images":
-		if images, ok := result.Data.(map[string]interface{}); ok {
-			o.context.CurrentState["images"] = images
-		}
-	case "generate_voice":
-		if audio, ok := result.Data.(map[string]interface{}); ok {
-			o.context.CurrentState["audio"] = audio
-		}
-	case "render_video":
-		if video, ok := result.Data.(map[string]interface{}); ok {
-			o.context.CurrentState["final_video"] = video
-			if videoFile, ok := video["video_file"].(string); ok {
-				o.context.Resources["final_video"] = videoFile
-			}
-		}
 	case "check_quality":
 		if quality, ok := result.Data.(map[string]interface{}); ok {
 			o.context.CurrentState["quality_check"] = quality
@@ -306,17 +324,12 @@ func (o *ToolBasedOrchestrator) updateContextFromToolResult(toolName string, res
 // buildFinalResult 构建最终结果
 func (o *ToolBasedOrchestrator) buildFinalResult() *model.ScriptOutput {
 	// 从上下文状态构建最终输出
-	result := &model.ScriptOutput{
-		TaskID: o.context.TaskID,
-		Status: "completed",
-	}
-
-	// 提取脚本信息
-	if script, ok := o.context.CurrentState["script"].(map[string]interface{}); ok {
-		if title, ok := script["title"].(string); ok {
-			result.Title = title
-		}
+	result := &model.ScriptOutput{}
+	if script, ok := o.context.Script(); ok {
+		*result = *script
 	}
+	result.TaskID = o.context.TaskID
+	result.Status = "completed"
 
 	// 提取最终视频路径
 	if finalVideo, ok := o.context.Resources["final_video"]; ok {
@@ -341,3 +354,22 @@ func (o *ToolBasedOrchestrator) GetCurrentState() map[string]interface{} {
 	}
 	return o.context.CurrentState
 }
+
+// buildResumeNote 描述上次执行已完成的内容，引导LLM只调用缺失步骤的工具
+func buildResumeNote(script *model.ScriptOutput) string {
+	var missingImages, missingVoices []int
+	for i, shot := range script.Shots {
+		if shot.ClipPath == "" {
+			missingImages = append(missingImages, i)
+		}
+		if shot.VoicePath == "" && shot.Voiceover != "" && script.Narration == "" {
+			missingVoices = append(missingVoices, i)
+		}
+	}
+
+	return fmt.Sprintf(`This is a retry of a failed attempt. The script "%s" with %d shots already exists and generate_script will return it unchanged.
+Shots still missing images: %v
+Shots still missing voice: %v
+Only generate what is missing (use start_shot / shot_index to target those shots), then call render_video.`,
+		script.Title, len(script.Shots), missingImages, missingVoices)
+}
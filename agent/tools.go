@@ -1,8 +1,13 @@
 package agent
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"video-agent-go/model"
 )
 
 // Tool 工具接口定义
@@ -10,7 +15,11 @@ type Tool interface {
 	GetName() string
 	GetDescription() string
 	GetParameters() ToolParameters
-	Execute(args map[string]interface{}) (*ToolResult, error)
+	// NewArgs 返回工具参数结构体的指针，注册中心把校验后的参数解码到其中再传给 Execute
+	NewArgs() interface{}
+	// Execute 执行工具，生成的资源通过 octx.Resources 以句柄形式在工具间传递；
+	// ctx 取消时应尽快返回 ctx.Err()
+	Execute(ctx context.Context, octx *ToolOrchestrationContext, args interface{}) (*ToolResult, error)
 }
 
 // ToolParameters 工具参数定义
@@ -26,6 +35,18 @@ type ToolProperty struct {
 	Description string      `json:"description"`
 	Enum        []string    `json:"enum,omitempty"`
 	Default     interface{} `json:"default,omitempty"`
+	Minimum     *float64    `json:"minimum,omitempty"` // 数值参数的下限
+	Maximum     *float64    `json:"maximum,omitempty"` // 数值参数的上限
+}
+
+// minimum 返回 ToolProperty.Minimum 使用的指针
+func minimum(v float64) *float64 {
+	return &v
+}
+
+// maximum 返回 ToolProperty.Maximum 使用的指针
+func maximum(v float64) *float64 {
+	return &v
 }
 
 // ToolResult 工具执行结果
@@ -45,9 +66,43 @@ type ToolCall struct {
 }
 
 // ToolFunction 工具函数调用
+// Arguments 与 chat completions 接口一致，是JSON编码后的字符串
 type ToolFunction struct {
-	Name      string                 `json:"name"`
-	Arguments map[string]interface{} `json:"arguments"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ParseArguments 解析参数字符串，空字符串视为没有参数
+func (f ToolFunction) ParseArguments() (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	if strings.TrimSpace(f.Arguments) == "" {
+		return args, nil
+	}
+	if err := json.Unmarshal([]byte(f.Arguments), &args); err != nil {
+		return nil, fmt.Errorf("arguments for %s are not a valid JSON object: %v", f.Name, err)
+	}
+	if args == nil {
+		args = make(map[string]interface{})
+	}
+	return args, nil
+}
+
+// normalizeToolCalls 将合法的参数重新序列化为规范的JSON字符串
+// 非法参数保持原样回传给模型，由执行阶段返回工具错误
+func normalizeToolCalls(calls []ToolCall) []ToolCall {
+	normalized := make([]ToolCall, len(calls))
+	for i, call := range calls {
+		if call.Type == "" {
+			call.Type = "function"
+		}
+		if args, err := call.Function.ParseArguments(); err == nil {
+			if data, err := json.Marshal(args); err == nil {
+				call.Function.Arguments = string(data)
+			}
+		}
+		normalized[i] = call
+	}
+	return normalized
 }
 
 // ToolRegistry 工具注册中心
@@ -75,10 +130,11 @@ func (tr *ToolRegistry) GetAllTools() map[string]Tool {
 	return tr.tools
 }
 
+// GetToolsSchema 返回按工具名排序的 function calling 声明，顺序固定以便计算版本
 func (tr *ToolRegistry) GetToolsSchema() []map[string]interface{} {
 	var schemas []map[string]interface{}
 
-	for _, tool := range tr.tools {
+	for _, tool := range tr.sortedTools() {
 		schema := map[string]interface{}{
 			"type": "function",
 			"function": map[string]interface{}{
@@ -93,8 +149,27 @@ func (tr *ToolRegistry) GetToolsSchema() []map[string]interface{} {
 	return schemas
 }
 
+// SchemaVersion 工具声明的哈希，任何工具的名称、描述或参数变化都会改变版本
+func (tr *ToolRegistry) SchemaVersion() string {
+	return schemaVersion(tr.GetToolsSchema())
+}
+
+func (tr *ToolRegistry) sortedTools() []Tool {
+	names := make([]string, 0, len(tr.tools))
+	for name := range tr.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]Tool, 0, len(names))
+	for _, name := range names {
+		tools = append(tools, tr.tools[name])
+	}
+	return tools
+}
+
 // ExecuteToolCall 执行工具调用
-func (tr *ToolRegistry) ExecuteToolCall(toolCall ToolCall) (*ToolResult, error) {
+func (tr *ToolRegistry) ExecuteToolCall(ctx context.Context, octx *ToolOrchestrationContext, toolCall ToolCall) (*ToolResult, error) {
 	tool, exists := tr.GetTool(toolCall.Function.Name)
 	if !exists {
 		return &ToolResult{
@@ -103,9 +178,35 @@ func (tr *ToolRegistry) ExecuteToolCall(toolCall ToolCall) (*ToolResult, error)
 		}, fmt.Errorf("tool not found: %s", toolCall.Function.Name)
 	}
 
-	log.Printf("🔧 Executing tool: %s with args: %v", toolCall.Function.Name, toolCall.Function.Arguments)
+	rawArgs, err := toolCall.Function.ParseArguments()
+	if err != nil {
+		log.Printf("❌ Invalid tool arguments: %v", err)
+		return &ToolResult{
+			Success: false,
+			Error:   err.Error(),
+		}, err
+	}
+
+	// 按参数声明校验并补全默认值，再解码为工具自己的参数结构体
+	validated, problems := tool.GetParameters().Validate(rawArgs)
+	args := tool.NewArgs()
+	if len(problems) == 0 {
+		problems = decodeToolArgs(validated, args)
+	}
+	if len(problems) > 0 {
+		log.Printf("❌ Invalid tool arguments for %s: %v", toolCall.Function.Name, problems)
+		return &ToolResult{
+			Success: false,
+			Error:   fmt.Sprintf("invalid arguments for %s", toolCall.Function.Name),
+			Data: map[string]interface{}{
+				"invalid_arguments": problems,
+			},
+		}, fmt.Errorf("invalid arguments for %s: %v", toolCall.Function.Name, problems)
+	}
+
+	log.Printf("🔧 Executing tool: %s with args: %v", toolCall.Function.Name, validated)
 
-	result, err := tool.Execute(toolCall.Function.Arguments)
+	result, err := tool.Execute(ctx, octx, args)
 	if err != nil {
 		log.Printf("❌ Tool execution failed: %v", err)
 		return &ToolResult{
@@ -153,7 +254,7 @@ func (t *ScriptGenerationTool) GetParameters() ToolParameters {
 				Default:     "professional",
 			},
 			"duration": {
-				Type:        "number",
+				Type:        "integer",
 				Description: "Target video duration in seconds",
 				Default:     60,
 			},
@@ -166,36 +267,88 @@ func (t *ScriptGenerationTool) GetParameters() ToolParameters {
 	}
 }
 
-func (t *ScriptGenerationTool) Execute(args map[string]interface{}) (*ToolResult, error) {
-	contentType := args["content_type"].(string)
-	audience := args["target_audience"].(string)
+// ScriptToolArgs generate_script 的参数
+type ScriptToolArgs struct {
+	ContentType    string   `json:"content_type"`
+	TargetAudience string   `json:"target_audience"`
+	Style          string   `json:"style"`
+	Duration       int      `json:"duration"`
+	KeyPoints      []string `json:"key_points"`
+}
+
+func (t *ScriptGenerationTool) NewArgs() interface{} {
+	return &ScriptToolArgs{}
+}
+
+func (t *ScriptGenerationTool) Execute(ctx context.Context, octx *ToolOrchestrationContext, args interface{}) (*ToolResult, error) {
+	params := args.(*ScriptToolArgs)
+
+	// 恢复的任务沿用已有脚本，已生成的素材仍然对应原来的镜头
+	script, reused := octx.Script()
+	if !reused || !octx.Resumed {
+		var err error
+		script, err = GenerateScript(ctx, model.UserInput{
+			Text:            buildScriptBrief(octx.UserRequest, params),
+			Images:          octx.ReferenceImages,
+			Video:           octx.SourceVideo,
+			Audio:           octx.UserAudio,
+			AudioRole:       octx.AudioRole,
+			SubtitleFormats: octx.SubtitleFormats,
+			Style:           params.Style,
+		})
+		if err != nil {
+			return nil, err
+		}
+		octx.CurrentState["script"] = script
+		octx.Checkpoints.SaveScript(script)
+	}
 
-	// 模拟脚本生成逻辑
-	script := map[string]interface{}{
-		"title":              fmt.Sprintf("Generated %s content for %s", contentType, audience),
-		"structure":          []string{"introduction", "main_content", "conclusion"},
-		"estimated_duration": args["duration"],
-		"shots": []map[string]interface{}{
-			{
-				"id":          1,
-				"scene":       "Opening scene",
-				"description": "Introduction to the topic",
-				"duration":    10,
-			},
-		},
+	// 把镜头信息返回给LLM，方便它为每个镜头选择图像提示词和旁白
+	shots := make([]map[string]interface{}, 0, len(script.Shots))
+	for i, shot := range script.Shots {
+		info := map[string]interface{}{
+			"shot_index":   i,
+			"scene":        shot.Scene,
+			"image_prompt": shot.ImagePrompt,
+			"voiceover":    shot.Voiceover,
+			"duration":     shot.Duration,
+			"image_ref":    shot.ImageRef,
+			"has_image":    shot.ClipPath != "",
+			"has_voice":    shot.VoicePath != "",
+		}
+		if shot.HasSource() {
+			info["source_start"] = shot.SourceStart
+			info["source_end"] = shot.SourceEnd
+		}
+		shots = append(shots, info)
 	}
 
 	return &ToolResult{
-		Success:   true,
-		Data:      script,
-		NextTools: []string{"generate_images", "generate_voice"}, // 建议下一步工具
-		Metadata: map[string]interface{}{
-			"processing_time": 2.5,
-			"confidence":      0.92,
+		Success: true,
+		Data: map[string]interface{}{
+			"title":  script.Title,
+			"style":  script.Style,
+			"shots":  shots,
+			"reused": reused && octx.Resumed,
 		},
+		NextTools: []string{"generate_images", "generate_voice"}, // 建议下一步工具
 	}, nil
 }
 
+// buildScriptBrief 把用户请求和LLM给出的创作要求合并为脚本生成的输入
+func buildScriptBrief(userRequest string, params *ScriptToolArgs) string {
+	var sb strings.Builder
+	sb.WriteString(userRequest)
+	sb.WriteString(fmt.Sprintf("\n\nContent type: %s\nTarget audience: %s", params.ContentType, params.TargetAudience))
+	if params.Duration > 0 {
+		sb.WriteString(fmt.Sprintf("\nTarget duration: about %d seconds", params.Duration))
+	}
+	if len(params.KeyPoints) > 0 {
+		sb.WriteString("\nKey points: " + strings.Join(params.KeyPoints, "; "))
+	}
+	return sb.String()
+}
+
 // ImageGenerationTool 图像生成工具
 type ImageGenerationTool struct{}
 
@@ -223,46 +376,102 @@ func (t *ImageGenerationTool) GetParameters() ToolParameters {
 			"resolution": {
 				Type:        "string",
 				Description: "Image resolution",
-				Enum:        []string{"1024x1024", "1920x1080", "512x512"},
+				Enum:        []string{"1024x1024", "1792x1024", "1024x1792"},
 				Default:     "1024x1024",
 			},
-			"count": {
-				Type:        "number",
-				Description: "Number of images to generate",
-				Default:     1,
+			"start_shot": {
+				Type:        "integer",
+				Description: "Shot index of the first prompt; prompt i is used for shot start_shot+i",
+				Default:     0,
+				Minimum:     minimum(0),
 			},
 		},
 		Required: []string{"prompts"},
 	}
 }
 
-func (t *ImageGenerationTool) Execute(args map[string]interface{}) (*ToolResult, error) {
-	prompts := args["prompts"].([]interface{})
-	style := args["style"].(string)
+// ImageToolArgs generate_images 的参数
+type ImageToolArgs struct {
+	Prompts    []string `json:"prompts"`
+	Style      string   `json:"style"`
+	Resolution string   `json:"resolution"`
+	StartShot  int      `json:"start_shot"`
+}
+
+func (t *ImageGenerationTool) NewArgs() interface{} {
+	return &ImageToolArgs{}
+}
+
+func (t *ImageGenerationTool) Execute(ctx context.Context, octx *ToolOrchestrationContext, args interface{}) (*ToolResult, error) {
+	params := args.(*ImageToolArgs)
+	script, hasScript := octx.Script()
 
-	// 模拟图像生成
 	var images []map[string]interface{}
-	for i, prompt := range prompts {
-		image := map[string]interface{}{
-			"id":     fmt.Sprintf("img_%d", i+1),
-			"prompt": prompt,
-			"url":    fmt.Sprintf("/uploads/images/generated_%d.jpg", i+1),
-			"style":  style,
+	var failures []string
+	for i, prompt := range params.Prompts {
+		shotIndex := params.StartShot + i
+		hasShot := hasScript && shotIndex >= 0 && shotIndex < len(script.Shots)
+
+		// 恢复的任务中已经生成过的图像直接复用，截取自源视频的镜头不需要图像
+		if hasShot && script.Shots[shotIndex].ClipPath != "" && (octx.Resumed || script.Shots[shotIndex].HasSource()) {
+			images = append(images, map[string]interface{}{
+				"handle":     imageHandle(shotIndex),
+				"shot_index": shotIndex,
+				"path":       script.Shots[shotIndex].ClipPath,
+				"reused":     true,
+			})
+			continue
+		}
+
+		// 镜头引用了用户提供的图像时使用该图像，不再生成
+		var imagePath string
+		var err error
+		reference := hasShot && script.Shots[shotIndex].ImageRef > 0
+		if reference {
+			imagePath, err = ReferenceImage(ctx, script.Shots[shotIndex], octx.ReferenceImages)
+		} else {
+			if params.Style != "" {
+				prompt = fmt.Sprintf("%s, %s style", prompt, params.Style)
+			}
+			imagePath, err = GenerateImageWithOptions(ctx, prompt, ImageOptions{Size: params.Resolution})
 		}
-		images = append(images, image)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Failed to generate image for shot %d: %v", shotIndex, err)
+			failures = append(failures, fmt.Sprintf("shot %d: %v", shotIndex, err))
+			continue
+		}
+
+		handle := imageHandle(shotIndex)
+		octx.Resources[handle] = imagePath
+		if hasShot {
+			script.Shots[shotIndex].ClipPath = imagePath
+			script.Shots[shotIndex].RenderedClip = ""
+		}
+		octx.Checkpoints.SaveShotImage(shotIndex, imagePath)
+
+		images = append(images, map[string]interface{}{
+			"handle":     handle,
+			"shot_index": shotIndex,
+			"path":       imagePath,
+			"reference":  reference,
+		})
+	}
+
+	if len(images) == 0 && len(params.Prompts) > 0 {
+		return nil, fmt.Errorf("all %d image generations failed: %s", len(params.Prompts), strings.Join(failures, "; "))
 	}
 
 	return &ToolResult{
 		Success: true,
 		Data: map[string]interface{}{
-			"images": images,
-			"count":  len(images),
-		},
-		NextTools: []string{"generate_voice", "analyze_quality"},
-		Metadata: map[string]interface{}{
-			"total_processing_time": 8.2,
-			"average_quality":       0.89,
+			"images":   images,
+			"count":    len(images),
+			"failures": failures,
 		},
+		NextTools: []string{"generate_voice", "check_quality"},
 	}, nil
 }
 
@@ -300,6 +509,8 @@ func (t *VoiceGenerationTool) GetParameters() ToolParameters {
 				Type:        "number",
 				Description: "Speech speed (0.5 to 2.0)",
 				Default:     1.0,
+				Minimum:     minimum(0.5),
+				Maximum:     maximum(2.0),
 			},
 			"emotion": {
 				Type:        "string",
@@ -307,34 +518,123 @@ func (t *VoiceGenerationTool) GetParameters() ToolParameters {
 				Enum:        []string{"neutral", "friendly", "professional", "enthusiastic"},
 				Default:     "neutral",
 			},
+			"shot_index": {
+				Type:        "integer",
+				Description: "Shot the narration belongs to; defaults to the first shot without narration",
+				Minimum:     minimum(0),
+			},
 		},
 		Required: []string{"text"},
 	}
 }
 
-func (t *VoiceGenerationTool) Execute(args map[string]interface{}) (*ToolResult, error) {
-	text := args["text"].(string)
-	voiceType := args["voice_type"].(string)
+// VoiceToolArgs generate_voice 的参数
+type VoiceToolArgs struct {
+	Text      string  `json:"text"`
+	VoiceType string  `json:"voice_type"`
+	Language  string  `json:"language"`
+	Speed     float64 `json:"speed"`
+	Emotion   string  `json:"emotion"`
+	ShotIndex *int    `json:"shot_index"`
+}
+
+// ttsVoices voice_type 到 TTS 音色的映射
+var ttsVoices = map[string]string{
+	"male":    "onyx",
+	"female":  "nova",
+	"neutral": "alloy",
+}
+
+func (t *VoiceGenerationTool) NewArgs() interface{} {
+	return &VoiceToolArgs{}
+}
 
-	// 模拟语音生成
-	audioFile := fmt.Sprintf("/uploads/audio/voice_%d.mp3", len(text)%1000)
+func (t *VoiceGenerationTool) Execute(ctx context.Context, octx *ToolOrchestrationContext, args interface{}) (*ToolResult, error) {
+	params := args.(*VoiceToolArgs)
+	script, hasScript := octx.Script()
+
+	// 用户提供了旁白录音时不再合成语音
+	if hasScript && script.Narration != "" {
+		return &ToolResult{
+			Success: true,
+			Data: map[string]interface{}{
+				"narration": script.Narration,
+				"skipped":   true,
+			},
+			NextTools: []string{"render_video"},
+		}, nil
+	}
+
+	// 确定旁白对应的镜头
+	shotIndex := -1
+	if params.ShotIndex != nil {
+		shotIndex = *params.ShotIndex
+	} else if hasScript {
+		for i, shot := range script.Shots {
+			if shot.VoicePath == "" {
+				shotIndex = i
+				break
+			}
+		}
+	}
+	if shotIndex < 0 {
+		shotIndex = countResources(octx.Resources, "voice_")
+	}
+	hasShot := hasScript && shotIndex >= 0 && shotIndex < len(script.Shots)
+
+	// 恢复的任务中已经合成过的配音直接复用
+	if octx.Resumed && hasShot && script.Shots[shotIndex].VoicePath != "" {
+		return &ToolResult{
+			Success: true,
+			Data: map[string]interface{}{
+				"handle":     voiceHandle(shotIndex),
+				"shot_index": shotIndex,
+				"audio_file": script.Shots[shotIndex].VoicePath,
+				"reused":     true,
+			},
+			NextTools: []string{"render_video", "check_quality"},
+		}, nil
+	}
+
+	voicePath, err := GenerateVoiceoverWithOptions(ctx, params.Text, VoiceOptions{
+		Voice: ttsVoices[params.VoiceType],
+		Speed: params.Speed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	handle := voiceHandle(shotIndex)
+	octx.Resources[handle] = voicePath
+	if hasShot {
+		script.Shots[shotIndex].VoicePath = voicePath
+		script.Shots[shotIndex].RenderedClip = ""
+	}
+	octx.Checkpoints.SaveShotVoice(shotIndex, voicePath)
 
 	return &ToolResult{
 		Success: true,
 		Data: map[string]interface{}{
-			"audio_file":  audioFile,
-			"duration":    len(text) / 10, // 简单估算
-			"voice_type":  voiceType,
-			"text_length": len(text),
-		},
-		NextTools: []string{"render_video", "analyze_quality"},
-		Metadata: map[string]interface{}{
-			"processing_time": 3.1,
-			"audio_quality":   0.95,
+			"handle":      handle,
+			"shot_index":  shotIndex,
+			"audio_file":  voicePath,
+			"voice_type":  params.VoiceType,
+			"text_length": len(params.Text),
 		},
+		NextTools: []string{"render_video", "check_quality"},
 	}, nil
 }
 
+func countResources(resources map[string]string, prefix string) int {
+	count := 0
+	for handle := range resources {
+		if strings.HasPrefix(handle, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
 // ContentAnalysisTool 内容分析工具
 type ContentAnalysisTool struct{}
 
@@ -363,8 +663,18 @@ func (t *ContentAnalysisTool) GetParameters() ToolParameters {
 	}
 }
 
-func (t *ContentAnalysisTool) Execute(args map[string]interface{}) (*ToolResult, error) {
-	userText := args["user_text"].(string)
+// ContentAnalysisArgs analyze_content 的参数
+type ContentAnalysisArgs struct {
+	UserText string                 `json:"user_text"`
+	Context  map[string]interface{} `json:"context"`
+}
+
+func (t *ContentAnalysisTool) NewArgs() interface{} {
+	return &ContentAnalysisArgs{}
+}
+
+func (t *ContentAnalysisTool) Execute(ctx context.Context, octx *ToolOrchestrationContext, args interface{}) (*ToolResult, error) {
+	userText := args.(*ContentAnalysisArgs).UserText
 
 	// 简单的内容分析逻辑
 	analysis := map[string]interface{}{
@@ -426,8 +736,19 @@ func (t *QualityCheckTool) GetParameters() ToolParameters {
 	}
 }
 
-func (t *QualityCheckTool) Execute(args map[string]interface{}) (*ToolResult, error) {
-	contentType := args["content_type"].(string)
+// QualityCheckArgs check_quality 的参数
+type QualityCheckArgs struct {
+	ContentType     string                 `json:"content_type"`
+	ContentData     map[string]interface{} `json:"content_data"`
+	QualityCriteria []string               `json:"quality_criteria"`
+}
+
+func (t *QualityCheckTool) NewArgs() interface{} {
+	return &QualityCheckArgs{}
+}
+
+func (t *QualityCheckTool) Execute(ctx context.Context, octx *ToolOrchestrationContext, args interface{}) (*ToolResult, error) {
+	contentType := args.(*QualityCheckArgs).ContentType
 
 	// 模拟质量检查
 	qualityScores := map[string]float64{
@@ -476,57 +797,82 @@ func (t *VideoRenderTool) GetName() string {
 }
 
 func (t *VideoRenderTool) GetDescription() string {
-	return "Render final video from script, images, and audio components"
+	return "Render the final video from the generated script, the shot images and the narration audio"
 }
 
 func (t *VideoRenderTool) GetParameters() ToolParameters {
 	return ToolParameters{
 		Type: "object",
 		Properties: map[string]ToolProperty{
-			"script": {
-				Type:        "object",
-				Description: "Video script with timing information",
-			},
-			"images": {
-				Type:        "array",
-				Description: "Array of image assets",
-			},
-			"audio": {
-				Type:        "object",
-				Description: "Audio narration data",
-			},
-			"effects": {
-				Type:        "array",
-				Description: "Visual effects to apply",
-			},
-			"output_format": {
+			"title": {
 				Type:        "string",
-				Description: "Output video format",
-				Enum:        []string{"mp4", "avi", "mov"},
-				Default:     "mp4",
+				Description: "Video title used for the output file name; defaults to the script title",
 			},
 		},
-		Required: []string{"script"},
+		Required: []string{},
 	}
 }
 
-func (t *VideoRenderTool) Execute(args map[string]interface{}) (*ToolResult, error) {
-	// 模拟视频渲染过程
-	outputFile := fmt.Sprintf("/uploads/videos/final_video_%d.mp4", 12345)
+// RenderToolArgs render_video 的参数
+type RenderToolArgs struct {
+	Title string `json:"title"`
+}
+
+func (t *VideoRenderTool) NewArgs() interface{} {
+	return &RenderToolArgs{}
+}
+
+func (t *VideoRenderTool) Execute(ctx context.Context, octx *ToolOrchestrationContext, args interface{}) (*ToolResult, error) {
+	params := args.(*RenderToolArgs)
+
+	script, ok := octx.Script()
+	if !ok {
+		return nil, fmt.Errorf("no script available, call generate_script first")
+	}
+
+	// 用资源句柄补齐镜头素材
+	var missing []int
+	for i := range script.Shots {
+		shot := &script.Shots[i]
+		if shot.ClipPath == "" {
+			shot.ClipPath = octx.Resources[imageHandle(i)]
+		}
+		if shot.VoicePath == "" {
+			shot.VoicePath = octx.Resources[voiceHandle(i)]
+		}
+		if shot.ClipPath == "" {
+			missing = append(missing, i)
+		}
+	}
+	// 每个镜头都需要画面才能渲染，缺少时让LLM从第一个缺失的镜头开始补齐
+	if len(missing) == len(script.Shots) {
+		return nil, fmt.Errorf("no shot has an image yet, call generate_images first")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("shots %v have no image yet, call generate_images with start_shot %d to fill them before rendering",
+			missing, missing[0])
+	}
+
+	renderScript := *script
+	if params.Title != "" {
+		renderScript.Title = params.Title
+	}
+
+	finalPath, err := RenderVideoWithOptions(ctx, &renderScript, renderOptionsFor(octx.TaskID, octx.Checkpoints))
+	if err != nil {
+		return nil, err
+	}
+
+	script.Final = finalPath
+	script.Subtitles = renderScript.Subtitles
+	octx.Resources["final_video"] = finalPath
 
 	return &ToolResult{
 		Success: true,
 		Data: map[string]interface{}{
-			"video_file": outputFile,
-			"duration":   95,
-			"resolution": "1920x1080",
-			"file_size":  "25.6MB",
-			"format":     "mp4",
-		},
-		Metadata: map[string]interface{}{
-			"render_time":   12.3,
-			"quality_score": 0.91,
-			"compression":   "h264",
+			"video_file": finalPath,
+			"subtitles":  script.Subtitles,
+			"shot_count": len(script.Shots),
 		},
 	}, nil
 }
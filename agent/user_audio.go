@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"video-agent-go/model"
+)
+
+// bgmVolume 背景音乐垫在旁白下面时的音量
+const bgmVolume = 0.2
+
+// userAudio 用户提供的音频及其用途
+type userAudio struct {
+	Role     model.AudioRole
+	Path     string
+	Duration float64
+}
+
+// prepareUserAudio 下载并测量用户提供的音频，没有音频时返回 nil。
+// URL 只从公网地址下载，大小受上传上限约束
+func prepareUserAudio(ctx context.Context, input model.UserInput) (*userAudio, error) {
+	role := input.AudioUsage()
+	if role == "" {
+		return nil, nil
+	}
+	if role != model.AudioNarration && role != model.AudioBGM {
+		return nil, fmt.Errorf("unknown audio_role %q", role)
+	}
+
+	path := input.Audio
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		downloaded, err := downloadMedia(ctx, path, filepath.Join("uploads", "audio"), string(role))
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s audio: %w", role, err)
+		}
+		path = downloaded
+	}
+
+	duration, err := ProbeDuration(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &userAudio{Role: role, Path: path, Duration: duration}, nil
+}
+
+// prompt 告诉LLM旁白已经录好，镜头时长应与录音长度一致
+func (a *userAudio) prompt() string {
+	if a.Role != model.AudioNarration {
+		return ""
+	}
+	return fmt.Sprintf("\n\nThe narration is a provided recording of %.1f seconds; no speech will be synthesized. "+
+		"Use voiceover for the text each shot covers (it becomes the subtitle), "+
+		"and plan shot durations so that they add up to the length of the recording.", a.Duration)
+}
+
+// apply 把音频写入脚本。旁白模式下按录音长度重新分配镜头时长，并清除已有的配音
+func (a *userAudio) apply(script *model.ScriptOutput) {
+	switch a.Role {
+	case model.AudioBGM:
+		script.BGMPath = a.Path
+	case model.AudioNarration:
+		script.Narration = a.Path
+		for i := range script.Shots {
+			script.Shots[i].VoicePath = ""
+		}
+		for _, shot := range script.Shots {
+			if shot.HasSource() {
+				// 剪辑模式的镜头时长由源视频片段决定，旁白直接铺在剪辑结果上
+				log.Printf("Narration laid over an edit as-is, shot durations follow the source cuts")
+				return
+			}
+		}
+		fitDurations(script.Shots, a.Duration)
+
+		// 转场重叠会缩短成片，把重叠的时长补回去后重新分配
+		sum := 0.0
+		for _, shot := range script.Shots {
+			sum += shotLength(shot)
+		}
+		if _, total := BuildTimeline(*script); total < sum {
+			fitDurations(script.Shots, a.Duration+sum-total)
+		}
+	}
+}
+
+// fitDurations 按LLM给出的时长比例分配总时长（向上取整到秒），每个镜头至少1秒，
+// 用最大余数法保证各镜头时长之和恰好等于总时长
+func fitDurations(shots []model.Shot, total float64) {
+	if len(shots) == 0 {
+		return
+	}
+	seconds := int(math.Ceil(total))
+	if seconds < len(shots) {
+		seconds = len(shots)
+	}
+
+	weight := 0
+	for _, shot := range shots {
+		weight += max(shot.Duration, 1)
+	}
+
+	spare := seconds - len(shots)
+	remainders := make([]float64, len(shots))
+	assigned := 0
+	for i := range shots {
+		share := float64(spare) * float64(max(shots[i].Duration, 1)) / float64(weight)
+		shots[i].Duration = 1 + int(share)
+		remainders[i] = share - math.Floor(share)
+		assigned += shots[i].Duration
+	}
+
+	for ; assigned < seconds; assigned++ {
+		best := 0
+		for i := range remainders {
+			if remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		shots[best].Duration++
+		remainders[best] = -1
+	}
+}
+
+// ProbeDuration 用 ffprobe 读取音视频文件的时长（秒）
+func ProbeDuration(ctx context.Context, path string) (float64, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe error on %s: %v", path, err)
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%s has no duration", path)
+	}
+	return duration, nil
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"video-agent-go/model"
+)
+
+func shotsWithDurations(durations ...int) []model.Shot {
+	shots := make([]model.Shot, len(durations))
+	for i, d := range durations {
+		shots[i].Duration = d
+	}
+	return shots
+}
+
+func durationsOf(shots []model.Shot) []int {
+	durations := make([]int, len(shots))
+	for i, shot := range shots {
+		durations[i] = shot.Duration
+	}
+	return durations
+}
+
+func TestFitDurations(t *testing.T) {
+	tests := []struct {
+		name   string
+		shots  []int
+		total  float64
+		expect []int
+	}{
+		{"exact split", []int{2, 4, 4}, 10, []int{2, 4, 4}},
+		{"rounds total up", []int{1, 1}, 5.2, []int{3, 3}},
+		// 分配 7 秒余量：2.33/2.33/2.33，余下1秒给第一个最大余数
+		{"equal remainders", []int{1, 1, 1}, 10, []int{4, 3, 3}},
+		// 分配 6 秒余量：4.2/1.2/0.6，余下1秒给余数最大的最后一个镜头
+		{"largest remainder", []int{7, 2, 1}, 9, []int{5, 2, 2}},
+		{"missing durations weigh one second", []int{0, 0, 2}, 8, []int{2, 2, 4}},
+		{"at least one second each", []int{5, 5, 5}, 1.5, []int{1, 1, 1}},
+		{"no shots", nil, 10, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shots := shotsWithDurations(tt.shots...)
+			fitDurations(shots, tt.total)
+			if got := durationsOf(shots); !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("got %v, want %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestApplyNarrationCompensatesTransitions(t *testing.T) {
+	script := &model.ScriptOutput{
+		Shots:      shotsWithDurations(4, 4, 4),
+		Transition: &model.Transition{Type: model.TransitionFade, Duration: 1},
+	}
+	script.Shots[0].VoicePath = "uploads/audio/voice.mp3"
+
+	audio := &userAudio{Role: model.AudioNarration, Path: "uploads/audio/narration.mp3", Duration: 12}
+	audio.apply(script)
+
+	// 两个1秒的转场吃掉2秒，镜头合计14秒才能铺满12秒的录音
+	if got, want := durationsOf(script.Shots), []int{5, 5, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got durations %v, want %v", got, want)
+	}
+	if _, total := BuildTimeline(*script); total < audio.Duration {
+		t.Errorf("timeline is %.1fs, shorter than the %.1fs narration", total, audio.Duration)
+	}
+	if script.Narration != audio.Path || script.Shots[0].VoicePath != "" {
+		t.Errorf("narration %q, shot voice %q", script.Narration, script.Shots[0].VoicePath)
+	}
+}
+
+func TestApplyNarrationKeepsSourceCuts(t *testing.T) {
+	script := &model.ScriptOutput{Shots: []model.Shot{
+		{SourceStart: 0, SourceEnd: 3, ClipPath: "uploads/videos/source.mp4", Duration: 3},
+		{ImagePrompt: "A skyline", Duration: 2},
+	}}
+	(&userAudio{Role: model.AudioNarration, Path: "narration.mp3", Duration: 20}).apply(script)
+
+	if got := durationsOf(script.Shots); !reflect.DeepEqual(got, []int{3, 2}) {
+		t.Errorf("edit durations changed to %v", got)
+	}
+}
+
+func TestMixNarrationKeepsVideoLength(t *testing.T) {
+	requireFFmpeg(t)
+	ctx := testContext(t)
+	dir := t.TempDir()
+
+	videoPath := filepath.Join(dir, "video.mp4")
+	narrationPath := filepath.Join(dir, "narration.m4a")
+	for _, args := range [][]string{
+		{"-f", "lavfi", "-i", "testsrc=size=320x240:rate=25:duration=2", "-pix_fmt", "yuv420p", "-y", videoPath},
+		{"-f", "lavfi", "-i", "sine=frequency=440:duration=4", "-c:a", "aac", "-y", narrationPath},
+	} {
+		if output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+			t.Fatalf("ffmpeg %v: %v: %s", args, err, lastLine(output))
+		}
+	}
+
+	mixed, err := mixUserAudio(ctx, videoPath, model.ScriptOutput{Narration: narrationPath}, dir)
+	if err != nil {
+		t.Fatalf("mixUserAudio: %v", err)
+	}
+	duration, err := ProbeDuration(ctx, mixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(duration-2) > 0.1 {
+		t.Errorf("mixed video is %.3fs, want the 2s of the cut", duration)
+	}
+}
+
+func TestPrepareUserAudioRefusesPrivateURL(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	input := model.UserInput{Audio: srv.URL + "/voice.mp3", AudioRole: model.AudioNarration}
+	if _, err := prepareUserAudio(context.Background(), input); err == nil || !strings.Contains(err.Error(), "non-public") {
+		t.Errorf("got %v, want the loopback audio URL refused", err)
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Error("audio download reached a loopback address")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -26,6 +27,8 @@ func main() {
 		server.WithHostPorts(fmt.Sprintf("%s:%d",
 			config.AppConfig.Server.Host,
 			config.AppConfig.Server.Port)),
+		// Leave room for multipart boundaries and form fields around an upload
+		server.WithMaxRequestBodySize(int(config.AppConfig.Storage.MaxUploadSize)+1<<20),
 	)
 
 	// Register routes
@@ -56,7 +59,7 @@ func setupGracefulShutdown(h *server.Hertz) {
 		}
 
 		// Shutdown server
-		if err := h.Shutdown(); err != nil {
+		if err := h.Shutdown(context.Background()); err != nil {
 			log.Printf("Server shutdown error: %v", err)
 		}
 
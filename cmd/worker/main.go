@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"video-agent-go/agent"
+	"video-agent-go/config"
+	"video-agent-go/model"
+	"video-agent-go/webhook"
+	"video-agent-go/worker"
+)
+
+func main() {
+	// Initialize configuration
+	config.Init()
+
+	// Initialize database
+	model.InitDB()
+	defer model.DB.Close()
+
+	// Stop leasing new jobs on SIGINT/SIGTERM and let running jobs finish
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Persist task events so the API server can stream them to clients
+	agent.GetObserverManager().AddSink(worker.PersistEvent)
+
+	// Deliver completion webhooks alongside job processing
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		webhook.NewDispatcher(config.AppConfig.Webhook).Run(ctx)
+	}()
+
+	pool := worker.NewPool(config.AppConfig.Worker)
+	pool.Run(ctx)
+	wg.Wait()
+
+	log.Println("Worker exited")
+}
@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +15,9 @@ type Config struct {
 	Server   ServerConfig
 	API      APIConfig
 	Storage  StorageConfig
+	Worker   WorkerConfig
+	Webhook  WebhookConfig
+	Subtitle SubtitleConfig
 }
 
 type DatabaseConfig struct {
@@ -30,50 +35,214 @@ type ServerConfig struct {
 
 type APIConfig struct {
 	OpenAIKey string
+	// OpenAIBaseURL is the root of an OpenAI-compatible API, e.g. https://api.openai.com/v1
+	OpenAIBaseURL string
+	// Chat models used by each LLM stage
+	ScriptModel   string
+	PlanningModel string
+	ToolModel     string
+	// Per-attempt timeouts for chat completions and media (image/TTS) calls
+	LLMTimeout   time.Duration
+	MediaTimeout time.Duration
+	// Overall deadlines for one call, covering every attempt and backoff wait
+	LLMDeadline   time.Duration
+	MediaDeadline time.Duration
+	// Retry policy for transient provider failures (429, 5xx, timeouts)
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
 }
 
 type StorageConfig struct {
 	Type   string
 	Bucket string
 	Region string
+	// Largest file accepted by the asset upload endpoint, in bytes
+	MaxUploadSize int64
+}
+
+type WorkerConfig struct {
+	// Number of jobs a worker process runs concurrently
+	Concurrency int
+	// How long a leased job stays owned without a heartbeat before it is re-queued
+	LeaseDuration     time.Duration
+	HeartbeatInterval time.Duration
+	// How often an idle worker polls the queue
+	PollInterval time.Duration
+	// How long the work dir of a failed task is kept for a retry
+	FailedRetention time.Duration
+}
+
+type WebhookConfig struct {
+	// Secret used to sign callback payloads with HMAC-SHA256
+	Secret string
+	// Per-request timeout for a single delivery attempt
+	Timeout time.Duration
+	// Failed deliveries are retried with exponential backoff up to MaxAttempts
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+type SubtitleConfig struct {
+	// How subtitles end up in the video: "burn" draws them into the frames,
+	// "soft" muxes them as a mov_text track, "off" only writes the files
+	Mode string
+	// Style used when burning subtitles in
+	Font     string
+	FontSize int
+	Outline  int
+	// Position is bottom, middle or top; Margin is the distance from that edge
+	Position string
+	Margin   int
+	// Voiceovers longer than MaxCueChars characters are split into several
+	// cues at sentence and clause boundaries
+	MaxCueChars int
+	// Silence kept after each shot's voiceover before the next shot starts
+	VoicePadding time.Duration
 }
 
 var AppConfig *Config
 
+// Default returns the configuration used when no environment variables are
+// set. Init starts from it and overrides fields from the environment.
+func Default() *Config {
+	return &Config{
+		Database: DatabaseConfig{
+			Host: "localhost",
+			Port: 3306,
+			User: "root",
+			Name: "video_agent",
+		},
+		Server: ServerConfig{
+			Host: "0.0.0.0",
+			Port: 8080,
+		},
+		API: APIConfig{
+			OpenAIBaseURL:  "https://api.openai.com/v1",
+			ScriptModel:    "gpt-4o",
+			PlanningModel:  "gpt-4",
+			ToolModel:      "gpt-4-turbo-preview",
+			LLMTimeout:     60 * time.Second,
+			MediaTimeout:   120 * time.Second,
+			LLMDeadline:    180 * time.Second,
+			MediaDeadline:  300 * time.Second,
+			MaxRetries:     3,
+			RetryBaseDelay: 500 * time.Millisecond,
+			RetryMaxDelay:  30 * time.Second,
+		},
+		Storage: StorageConfig{
+			Type:          "local",
+			Region:        "us-west-2",
+			MaxUploadSize: 200 << 20,
+		},
+		Worker: WorkerConfig{
+			Concurrency:       2,
+			LeaseDuration:     60 * time.Second,
+			HeartbeatInterval: 15 * time.Second,
+			PollInterval:      time.Second,
+			FailedRetention:   72 * time.Hour,
+		},
+		Webhook: WebhookConfig{
+			Timeout:        10 * time.Second,
+			MaxAttempts:    8,
+			RetryBaseDelay: 10 * time.Second,
+			RetryMaxDelay:  time.Hour,
+		},
+		Subtitle: SubtitleConfig{
+			Mode:         "burn",
+			Font:         "Arial",
+			FontSize:     24,
+			Outline:      2,
+			Position:     "bottom",
+			Margin:       30,
+			MaxCueChars:  40,
+			VoicePadding: 500 * time.Millisecond,
+		},
+	}
+}
+
 func Init() {
 	// Load .env file if exists
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
 
-	port, _ := strconv.Atoi(getEnv("SERVER_PORT", "8080"))
-	dbPort, _ := strconv.Atoi(getEnv("DB_PORT", "3306"))
-
+	def := Default()
 	AppConfig = &Config{
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     dbPort,
-			User:     getEnv("DB_USER", "root"),
-			Password: getEnv("DB_PASSWORD", ""),
-			Name:     getEnv("DB_NAME", "video_agent"),
+			Host:     getEnv("DB_HOST", def.Database.Host),
+			Port:     getEnvInt("DB_PORT", def.Database.Port),
+			User:     getEnv("DB_USER", def.Database.User),
+			Password: getEnv("DB_PASSWORD", def.Database.Password),
+			Name:     getEnv("DB_NAME", def.Database.Name),
 		},
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
-			Port: port,
+			Host: getEnv("SERVER_HOST", def.Server.Host),
+			Port: getEnvInt("SERVER_PORT", def.Server.Port),
 		},
 		API: APIConfig{
-			OpenAIKey: getEnv("OPENAI_API_KEY", ""),
+			OpenAIKey:      getEnv("OPENAI_API_KEY", def.API.OpenAIKey),
+			OpenAIBaseURL:  getEnv("OPENAI_BASE_URL", def.API.OpenAIBaseURL),
+			ScriptModel:    getEnv("OPENAI_SCRIPT_MODEL", def.API.ScriptModel),
+			PlanningModel:  getEnv("OPENAI_PLANNING_MODEL", def.API.PlanningModel),
+			ToolModel:      getEnv("OPENAI_TOOL_MODEL", def.API.ToolModel),
+			LLMTimeout:     getEnvSeconds("LLM_TIMEOUT_SECONDS", def.API.LLMTimeout),
+			MediaTimeout:   getEnvSeconds("MEDIA_TIMEOUT_SECONDS", def.API.MediaTimeout),
+			LLMDeadline:    getEnvSeconds("LLM_DEADLINE_SECONDS", def.API.LLMDeadline),
+			MediaDeadline:  getEnvSeconds("MEDIA_DEADLINE_SECONDS", def.API.MediaDeadline),
+			MaxRetries:     getEnvInt("PROVIDER_MAX_RETRIES", def.API.MaxRetries),
+			RetryBaseDelay: getEnvMillis("PROVIDER_RETRY_BASE_MS", def.API.RetryBaseDelay),
+			RetryMaxDelay:  getEnvSeconds("PROVIDER_RETRY_MAX_SECONDS", def.API.RetryMaxDelay),
 		},
 		Storage: StorageConfig{
-			Type:   getEnv("STORAGE_TYPE", "local"),
-			Bucket: getEnv("CLOUD_BUCKET", ""),
-			Region: getEnv("CLOUD_REGION", "us-west-2"),
+			Type:          getEnv("STORAGE_TYPE", def.Storage.Type),
+			Bucket:        getEnv("CLOUD_BUCKET", def.Storage.Bucket),
+			Region:        getEnv("CLOUD_REGION", def.Storage.Region),
+			MaxUploadSize: int64(getEnvInt("UPLOAD_MAX_MB", int(def.Storage.MaxUploadSize>>20))) << 20,
+		},
+		Worker: WorkerConfig{
+			Concurrency:       getEnvInt("WORKER_CONCURRENCY", def.Worker.Concurrency),
+			LeaseDuration:     getEnvSeconds("WORKER_LEASE_SECONDS", def.Worker.LeaseDuration),
+			HeartbeatInterval: getEnvSeconds("WORKER_HEARTBEAT_SECONDS", def.Worker.HeartbeatInterval),
+			PollInterval:      getEnvMillis("WORKER_POLL_MS", def.Worker.PollInterval),
+			FailedRetention:   getEnvSeconds("WORKER_FAILED_RETENTION_SECONDS", def.Worker.FailedRetention),
+		},
+		Webhook: WebhookConfig{
+			Secret:         getEnv("WEBHOOK_SECRET", def.Webhook.Secret),
+			Timeout:        getEnvSeconds("WEBHOOK_TIMEOUT_SECONDS", def.Webhook.Timeout),
+			MaxAttempts:    getEnvInt("WEBHOOK_MAX_ATTEMPTS", def.Webhook.MaxAttempts),
+			RetryBaseDelay: getEnvSeconds("WEBHOOK_RETRY_BASE_SECONDS", def.Webhook.RetryBaseDelay),
+			RetryMaxDelay:  getEnvSeconds("WEBHOOK_RETRY_MAX_SECONDS", def.Webhook.RetryMaxDelay),
+		},
+		Subtitle: SubtitleConfig{
+			Mode:         getEnv("SUBTITLE_MODE", def.Subtitle.Mode),
+			Font:         getEnv("SUBTITLE_FONT", def.Subtitle.Font),
+			FontSize:     getEnvInt("SUBTITLE_FONT_SIZE", def.Subtitle.FontSize),
+			Outline:      getEnvInt("SUBTITLE_OUTLINE", def.Subtitle.Outline),
+			Position:     getEnv("SUBTITLE_POSITION", def.Subtitle.Position),
+			Margin:       getEnvInt("SUBTITLE_MARGIN", def.Subtitle.Margin),
+			MaxCueChars:  getEnvInt("SUBTITLE_MAX_CHARS", def.Subtitle.MaxCueChars),
+			VoicePadding: getEnvMillis("VOICE_PADDING_MS", def.Subtitle.VoicePadding),
 		},
 	}
 
-	// Validate required config
+	// Validate required config. Self-hosted or local OpenAI-compatible
+	// servers usually don't need a key, so only insist on it for OpenAI.
 	if AppConfig.API.OpenAIKey == "" {
-		log.Fatal("OPENAI_API_KEY is required")
+		if strings.Contains(AppConfig.API.OpenAIBaseURL, "api.openai.com") {
+			log.Fatal("OPENAI_API_KEY is required")
+		}
+		log.Printf("OPENAI_API_KEY is empty, calling %s without a key", AppConfig.API.OpenAIBaseURL)
+	}
+	switch AppConfig.Subtitle.Mode {
+	case "burn", "soft", "off":
+	default:
+		log.Printf("Unknown SUBTITLE_MODE %q, burning subtitles in", AppConfig.Subtitle.Mode)
+		AppConfig.Subtitle.Mode = "burn"
+	}
+	if AppConfig.Webhook.Secret == "" {
+		log.Println("WEBHOOK_SECRET is empty, tasks with a callback_url will be rejected")
 	}
 }
 
@@ -83,3 +252,23 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvSeconds(key string, defaultValue time.Duration) time.Duration {
+	seconds := getEnvInt(key, 0)
+	if seconds == 0 {
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func getEnvMillis(key string, defaultValue time.Duration) time.Duration {
+	return time.Duration(getEnvInt(key, int(defaultValue/time.Millisecond))) * time.Millisecond
+}
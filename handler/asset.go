@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/google/uuid"
+
+	"video-agent-go/config"
+	"video-agent-go/model"
+	"video-agent-go/storage"
+)
+
+// assetTypes 允许上传的格式，按文件内容嗅探出的 MIME 类型判断，不信任客户端声明的类型
+var assetTypes = map[string]struct {
+	kind model.AssetKind
+	ext  string
+}{
+	"image/jpeg":      {model.AssetImage, ".jpg"},
+	"image/png":       {model.AssetImage, ".png"},
+	"image/gif":       {model.AssetImage, ".gif"},
+	"image/webp":      {model.AssetImage, ".webp"},
+	"audio/mpeg":      {model.AssetAudio, ".mp3"},
+	"audio/wave":      {model.AssetAudio, ".wav"},
+	"application/ogg": {model.AssetAudio, ".ogg"},
+	"audio/mp4":       {model.AssetAudio, ".m4a"},
+	"audio/aac":       {model.AssetAudio, ".aac"},
+	"video/mp4":       {model.AssetVideo, ".mp4"},
+	"video/webm":      {model.AssetVideo, ".webm"},
+	"video/avi":       {model.AssetVideo, ".avi"},
+}
+
+// sniffContentType 按文件头判断 MIME 类型。http.DetectContentType 只认带 ID3 标签的 MP3，
+// 不认 AAC，还会把 M4A 当成 MP4 视频，这几种音频在这里补充判断
+func sniffContentType(head []byte) string {
+	// ISO 媒体文件以 ftyp box 开头，主品牌为 M4A / M4B 的是纯音频
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		if brand := string(head[8:12]); brand == "M4A " || brand == "M4B " {
+			return "audio/mp4"
+		}
+	}
+
+	mimeType := strings.TrimSpace(strings.Split(http.DetectContentType(head), ";")[0])
+	if mimeType != "application/octet-stream" {
+		return mimeType
+	}
+	switch {
+	case isADTSFrame(head):
+		return "audio/aac"
+	case isMPEGAudioFrame(head):
+		return "audio/mpeg"
+	}
+	return mimeType
+}
+
+// isMPEGAudioFrame 判断是否以没有 ID3 标签的 MPEG 音频帧开头：11 位同步字，
+// 版本、层、码率和采样率都不是保留值
+func isMPEGAudioFrame(b []byte) bool {
+	return len(b) >= 3 && b[0] == 0xFF && b[1]&0xE0 == 0xE0 &&
+		(b[1]>>3)&0x3 != 1 && (b[1]>>1)&0x3 != 0 &&
+		b[2]>>4 != 0xF && (b[2]>>2)&0x3 != 3
+}
+
+// isADTSFrame 判断是否以 ADTS 封装的 AAC 帧开头：12 位同步字，层固定为 0
+func isADTSFrame(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xFF && b[1]&0xF6 == 0xF0
+}
+
+// assetStorage 上传的素材保存在 uploads/assets 下，worker 通过共享目录读取
+var assetStorage = storage.NewLocalStorage("uploads")
+
+// UploadAsset 接收 multipart 上传（字段名 file，可重复），返回素材ID。
+// 生成接口的 images / audio / video 字段可以直接引用这些ID
+func UploadAsset(ctx context.Context, c *app.RequestContext) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Expected a multipart/form-data body")
+		return
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		respondWithError(c, http.StatusBadRequest, "No file uploaded, use the \"file\" form field")
+		return
+	}
+
+	maxSize := config.AppConfig.Storage.MaxUploadSize
+	for _, fh := range files {
+		if fh.Size > maxSize {
+			respondWithError(c, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("File %q exceeds the upload limit of %d MB", fh.Filename, maxSize>>20))
+			return
+		}
+	}
+
+	assets := make([]*model.Asset, 0, len(files))
+	for _, fh := range files {
+		asset, status, err := saveAsset(fh)
+		if err != nil {
+			if status == http.StatusInternalServerError {
+				log.Printf("Failed to store upload %q: %v", fh.Filename, err)
+				respondWithError(c, status, "Failed to store upload")
+			} else {
+				respondWithError(c, status, err.Error())
+			}
+			return
+		}
+		assets = append(assets, asset)
+	}
+
+	respondWithData(c, map[string]interface{}{
+		"assets": assets,
+	})
+}
+
+// saveAsset 嗅探文件类型后写入存储并记录到数据库，返回失败时应使用的状态码
+func saveAsset(fh *multipart.FileHeader) (*model.Asset, int, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, http.StatusBadRequest, err
+	}
+	head = head[:n]
+
+	mimeType := sniffContentType(head)
+	format, ok := assetTypes[mimeType]
+	if !ok {
+		return nil, http.StatusUnsupportedMediaType,
+			fmt.Errorf("file %q has unsupported type %s", fh.Filename, mimeType)
+	}
+
+	id := model.AssetIDPrefix + strings.ReplaceAll(uuid.New().String(), "-", "")
+	dest := filepath.Join("assets", id+format.ext)
+	path, err := assetStorage.Write(dest, io.MultiReader(bytes.NewReader(head), file))
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	asset := &model.Asset{
+		ID:           id,
+		Kind:         format.kind,
+		MimeType:     mimeType,
+		Size:         fh.Size,
+		OriginalName: filepath.Base(fh.Filename),
+		Path:         path,
+	}
+
+	// 云存储模式下额外上传一份，处理时仍使用本地文件
+	if config.AppConfig.Storage.Type == "cloud" {
+		url, err := storage.UploadToCloud(path, filepath.ToSlash(dest))
+		if err != nil {
+			log.Printf("Failed to upload asset %s to cloud storage: %v", id, err)
+		} else {
+			asset.URL = url
+		}
+	}
+
+	if err := model.SaveAsset(asset); err != nil {
+		os.Remove(path)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	log.Printf("📎 Stored %s asset %s (%s, %d bytes)", asset.Kind, asset.ID, asset.MimeType, asset.Size)
+	return asset, http.StatusOK, nil
+}
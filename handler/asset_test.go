@@ -0,0 +1,25 @@
+package handler
+
+import "testing"
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"mp3 with ID3 tag", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "audio/mpeg"},
+		{"bare mp3 frame", []byte{0xFF, 0xFB, 0x90, 0x64, 0x00}, "audio/mpeg"},
+		{"mpeg-2 layer 3 frame", []byte{0xFF, 0xF3, 0x48, 0xC4, 0x00}, "audio/mpeg"},
+		{"adts aac", []byte{0xFF, 0xF1, 0x50, 0x80, 0x02, 0x1F, 0xFC}, "audio/aac"},
+		{"m4a", []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x02\x00M4A mp42isom"), "audio/mp4"},
+		{"mp4 video", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), "video/mp4"},
+		{"reserved bitrate", []byte{0xFF, 0xFB, 0xF0, 0x64, 0x00}, "application/octet-stream"},
+		{"random bytes", []byte{0x12, 0x34, 0x56, 0x78, 0x00}, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := sniffContentType(tt.head); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/http1/resp"
+
+	"video-agent-go/agent"
+	"video-agent-go/model"
+)
+
+const (
+	// eventPollInterval 中继从数据库拉取 worker 事件的间隔
+	eventPollInterval = 500 * time.Millisecond
+	// eventPollBatch 每次最多拉取的事件数
+	eventPollBatch = 200
+	// keepaliveInterval 没有事件时发送注释行，防止代理断开空闲连接
+	keepaliveInterval = 15 * time.Second
+)
+
+// eventRelay 为有订阅者的任务轮询 task_events，把 worker 写入的事件转发到本进程的观察者中心
+type eventRelay struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+var relay = &eventRelay{running: make(map[string]bool)}
+
+// ensure 保证任务有一个中继在运行，应在订阅之后调用
+func (r *eventRelay) ensure(taskID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running[taskID] {
+		return
+	}
+	r.running[taskID] = true
+	go r.run(taskID)
+}
+
+func (r *eventRelay) run(taskID string) {
+	om := agent.GetObserverManager()
+	var lastID int64
+	for {
+		events, err := model.ListTaskEvents(taskID, lastID, eventPollBatch)
+		if err != nil {
+			log.Printf("Failed to load events of task %s: %v", taskID, err)
+		}
+		for _, event := range events {
+			om.Deliver(event)
+			lastID = event.ID
+		}
+
+		if r.idle(taskID) {
+			return
+		}
+		if len(events) < eventPollBatch {
+			time.Sleep(eventPollInterval)
+		}
+	}
+}
+
+// idle 最后一个订阅者离开后停止中继并丢弃事件历史，下次订阅时从数据库重新加载
+func (r *eventRelay) idle(taskID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	om := agent.GetObserverManager()
+	if om.SubscriberCount(taskID) > 0 {
+		return false
+	}
+	delete(r.running, taskID)
+	om.RemoveTask(taskID)
+	return true
+}
+
+// recordStatusEvent 记录 API 进程中发生的状态变化（取消、重试），与 worker 事件一起推送给订阅者
+func recordStatusEvent(status *model.ExtendedTaskStatus, message string) {
+	event := model.TaskEvent{
+		TaskID:   status.TaskID,
+		Type:     model.EventStatus,
+		Status:   status.Status,
+		Progress: status.Progress,
+		Message:  message,
+	}
+	if err := model.SaveTaskEvent(&event); err != nil {
+		log.Printf("Failed to record %s event for task %s: %v", status.Status, status.TaskID, err)
+	}
+}
+
+// StreamTaskEvents 以 Server-Sent Events 推送任务的状态、工具调用和智能体步骤。
+// 支持 Last-Event-ID 请求头或 after 查询参数续传，任务完成、取消或失败后关闭连接，
+// 重试失败的任务后客户端可以带上 Last-Event-ID 重新连接
+func StreamTaskEvents(ctx context.Context, c *app.RequestContext) {
+	taskID := c.Param("taskId")
+
+	task, err := model.GetTask(taskID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(c, http.StatusNotFound, "Task not found")
+			return
+		}
+		log.Printf("Failed to get task %s: %v", taskID, err)
+		respondWithError(c, http.StatusInternalServerError, "Failed to get task")
+		return
+	}
+
+	afterID, err := lastEventID(c)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid event id")
+		return
+	}
+
+	c.SetStatusCode(http.StatusOK)
+	c.Response.Header.Set("Content-Type", "text/event-stream")
+	c.Response.Header.Set("Cache-Control", "no-cache")
+	c.Response.Header.Set("Connection", "keep-alive")
+	c.Response.Header.Set("X-Accel-Buffering", "no")
+	c.Response.HijackWriter(resp.NewChunkedBodyWriter(&c.Response, c.GetWriter()))
+
+	if task.Status.IsFinished() {
+		streamFinishedTask(c, task, afterID)
+		return
+	}
+
+	om := agent.GetObserverManager()
+	sub, replay := om.Subscribe(taskID, afterID)
+	defer om.Unsubscribe(sub)
+	relay.ensure(taskID)
+
+	for _, event := range replay {
+		if err := writeEvent(c, event); err != nil || isFinalEvent(event) {
+			return
+		}
+	}
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				// 订阅因消费过慢被关闭，客户端会带着 Last-Event-ID 重新连接
+				return
+			}
+			if err := writeEvent(c, event); err != nil || isFinalEvent(event) {
+				return
+			}
+		case <-keepalive.C:
+			if err := writeFrame(c, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamFinishedTask 任务已结束时直接回放数据库中的事件；早于事件记录的任务补发一条最终状态
+func streamFinishedTask(c *app.RequestContext, task *model.VideoTask, afterID int64) {
+	finished := false
+	for {
+		events, err := model.ListTaskEvents(task.TaskID, afterID, eventPollBatch)
+		if err != nil {
+			log.Printf("Failed to load events of task %s: %v", task.TaskID, err)
+			return
+		}
+		for _, event := range events {
+			if err := writeEvent(c, event); err != nil {
+				return
+			}
+			afterID = event.ID
+			finished = finished || event.IsFinished()
+		}
+		if len(events) < eventPollBatch {
+			break
+		}
+	}
+
+	if !finished && afterID == 0 {
+		writeEvent(c, model.TaskEvent{
+			TaskID:    task.TaskID,
+			Type:      model.EventStatus,
+			Status:    string(task.Status),
+			Progress:  task.Progress,
+			Message:   task.Error,
+			CreatedAt: task.UpdatedAt,
+		})
+	}
+}
+
+// isFinalEvent 判断推送是否应在该事件后结束：任务已停止执行，且该事件是最新的一条。
+// 失败的任务可能已被重试，回放到旧的失败事件时不能结束推送
+func isFinalEvent(event model.TaskEvent) bool {
+	if !event.IsFinished() {
+		return false
+	}
+	task, err := model.GetTask(event.TaskID)
+	if err != nil {
+		return true
+	}
+	if !task.Status.IsFinished() {
+		return false
+	}
+	later, err := model.ListTaskEvents(event.TaskID, event.ID, 1)
+	return err != nil || len(later) == 0
+}
+
+// lastEventID 读取客户端已收到的最后一个事件ID，重连时浏览器会通过 Last-Event-ID 请求头带上
+func lastEventID(c *app.RequestContext) (int64, error) {
+	value := string(c.GetHeader("Last-Event-ID"))
+	if value == "" {
+		value = c.Query("after")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func writeEvent(c *app.RequestContext, event model.TaskEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	frame := fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, data)
+	if event.ID > 0 {
+		frame = fmt.Sprintf("id: %d\n", event.ID) + frame
+	}
+	return writeFrame(c, frame)
+}
+
+func writeFrame(c *app.RequestContext, frame string) error {
+	if _, err := c.Write([]byte(frame)); err != nil {
+		return err
+	}
+	return c.Flush()
+}
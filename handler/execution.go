@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+
+	"video-agent-go/model"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// executionPage 一页执行记录
+type executionPage struct {
+	Records  []model.ExecutionRecord
+	Total    int
+	Page     int
+	PageSize int
+}
+
+// listExecutions 按 page / page_size 查询参数分页读取任务的执行记录。
+// 出错时已经写好错误响应，调用方直接返回即可
+func listExecutions(c *app.RequestContext, taskID string, kind model.ExecutionKind) (*executionPage, error) {
+	page, pageSize, err := pagination(c)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return nil, err
+	}
+
+	if _, err := model.GetTask(taskID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(c, http.StatusNotFound, "Task not found")
+			return nil, err
+		}
+		log.Printf("Failed to get task %s: %v", taskID, err)
+		respondWithError(c, http.StatusInternalServerError, "Failed to get task")
+		return nil, err
+	}
+
+	records, total, err := model.ListExecutionRecords(taskID, kind, (page-1)*pageSize, pageSize)
+	if err != nil {
+		log.Printf("Failed to list %s records of task %s: %v", kind, taskID, err)
+		respondWithError(c, http.StatusInternalServerError, "Failed to get execution log")
+		return nil, err
+	}
+
+	return &executionPage{Records: records, Total: total, Page: page, PageSize: pageSize}, nil
+}
+
+// pagination 解析分页参数，page 从1开始，page_size 默认50、最大200
+func pagination(c *app.RequestContext) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+
+	if value := c.Query("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return 0, 0, errors.New("page must be a positive integer")
+		}
+		page = n
+	}
+	if value := c.Query("page_size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, errors.New("page_size must be between 1 and 200")
+		}
+		pageSize = n
+	}
+	return page, pageSize, nil
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/cloudwego/hertz/pkg/app"
+
+	"video-agent-go/model"
+	"video-agent-go/subtitle"
+	"video-agent-go/webhook"
+)
+
+// newTaskStatus 任务刚创建时返回给客户端的状态
+func newTaskStatus(taskID string, mode model.TaskMode) model.ExtendedTaskStatus {
+	return model.ExtendedTaskStatus{
+		TaskID:          taskID,
+		Status:          string(model.TaskStatePending),
+		Mode:            string(mode),
+		Progress:        0,
+		ProcessingSteps: model.ProcessingSteps(mode),
+	}
+}
+
+// validateInput 检查回调地址和引用的素材，不合法时写入错误响应并返回 false。
+// 素材ID在这里只做校验，任务输入中保留ID，由 worker 处理前解析为本地路径
+func validateInput(c *app.RequestContext, input model.UserInput) bool {
+	if input.CallbackURL != "" {
+		if err := webhook.ValidateCallback(input.CallbackURL); err != nil {
+			respondWithError(c, http.StatusBadRequest, err.Error())
+			return false
+		}
+	}
+
+	if input.AudioRole != "" && input.AudioRole != model.AudioNarration && input.AudioRole != model.AudioBGM {
+		respondWithError(c, http.StatusBadRequest, fmt.Sprintf("audio_role must be %q or %q", model.AudioNarration, model.AudioBGM))
+		return false
+	}
+
+	for _, name := range input.SubtitleFormats {
+		if _, err := subtitle.ParseFormat(name); err != nil {
+			respondWithError(c, http.StatusBadRequest, err.Error())
+			return false
+		}
+	}
+
+	if err := model.ResolveAssets(&input); err != nil {
+		var assetErr *model.AssetError
+		var fieldErr model.FieldError
+		if errors.As(err, &assetErr) || errors.As(err, &fieldErr) {
+			respondWithError(c, http.StatusBadRequest, err.Error())
+			return false
+		}
+		log.Printf("Failed to resolve assets: %v", err)
+		respondWithError(c, http.StatusInternalServerError, "Failed to resolve assets")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+
+	"video-agent-go/model"
+	"video-agent-go/webhook"
+)
+
+// ListWebhookDeliveries 列出任务的回调投递记录及每次尝试的结果
+func ListWebhookDeliveries(ctx context.Context, c *app.RequestContext) {
+	taskID := c.Param("taskId")
+
+	if _, err := model.GetTask(taskID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(c, http.StatusNotFound, "Task not found")
+			return
+		}
+		log.Printf("Failed to get task %s: %v", taskID, err)
+		respondWithError(c, http.StatusInternalServerError, "Failed to get task")
+		return
+	}
+
+	deliveries, err := model.ListWebhookDeliveries(taskID)
+	if err != nil {
+		log.Printf("Failed to list webhooks of task %s: %v", taskID, err)
+		respondWithError(c, http.StatusInternalServerError, "Failed to list webhook deliveries")
+		return
+	}
+	if deliveries == nil {
+		deliveries = []model.WebhookDelivery{}
+	}
+
+	respondWithData(c, map[string]interface{}{
+		"task_id":    taskID,
+		"deliveries": deliveries,
+	})
+}
+
+// RedeliverWebhook 立即重新投递一条回调，无论之前是否投递成功
+func RedeliverWebhook(ctx context.Context, c *app.RequestContext) {
+	id, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, "Invalid delivery id")
+		return
+	}
+
+	if err := model.RedeliverWebhook(id, webhook.MaxAttempts()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(c, http.StatusNotFound, "Webhook delivery not found")
+			return
+		}
+		log.Printf("Failed to redeliver webhook %d: %v", id, err)
+		respondWithError(c, http.StatusInternalServerError, "Failed to redeliver webhook")
+		return
+	}
+
+	delivery, err := model.GetWebhookDelivery(id)
+	if err != nil {
+		log.Printf("Failed to get webhook %d: %v", id, err)
+		respondWithError(c, http.StatusInternalServerError, "Failed to get webhook delivery")
+		return
+	}
+
+	respondWithData(c, delivery)
+}
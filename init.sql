@@ -1,8 +1,110 @@
-
-CREATE TABLE video_tasks (
+CREATE TABLE IF NOT EXISTS video_tasks (
   id INT AUTO_INCREMENT PRIMARY KEY,
   task_id VARCHAR(255) NOT NULL,
   input TEXT,
   output TEXT,
+  status VARCHAR(32) NOT NULL DEFAULT 'pending',
+  stage VARCHAR(64) NOT NULL DEFAULT '',
+  progress INT NOT NULL DEFAULT 0,
+  error TEXT,
+  mode VARCHAR(32) NOT NULL DEFAULT 'fixed',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  UNIQUE KEY uk_task_id (task_id),
+  KEY idx_status (status)
+);
+
+CREATE TABLE IF NOT EXISTS video_jobs (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  task_id VARCHAR(255) NOT NULL,
+  job_type VARCHAR(32) NOT NULL,
+  status VARCHAR(32) NOT NULL DEFAULT 'queued',
+  attempts INT NOT NULL DEFAULT 0,
+  max_attempts INT NOT NULL DEFAULT 3,
+  worker_id VARCHAR(255) NOT NULL DEFAULT '',
+  lease_expires_at DATETIME NULL,
+  last_error TEXT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  KEY idx_status_id (status, id),
+  KEY idx_lease (status, lease_expires_at),
+  KEY idx_task_id (task_id)
+);
+
+CREATE TABLE IF NOT EXISTS task_checkpoints (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  task_id VARCHAR(255) NOT NULL,
+  kind VARCHAR(32) NOT NULL,
+  shot_index INT NOT NULL DEFAULT -1,
+  value MEDIUMTEXT NOT NULL,
+  updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  UNIQUE KEY uk_task_kind_shot (task_id, kind, shot_index)
+);
+
+CREATE TABLE IF NOT EXISTS task_events (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  task_id VARCHAR(255) NOT NULL,
+  type VARCHAR(32) NOT NULL,
+  status VARCHAR(32) NOT NULL DEFAULT '',
+  progress INT NOT NULL DEFAULT 0,
+  message TEXT,
+  data MEDIUMTEXT,
+  created_at DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  KEY idx_task_id_id (task_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  task_id VARCHAR(255) NOT NULL,
+  event VARCHAR(32) NOT NULL,
+  url VARCHAR(2048) NOT NULL,
+  payload MEDIUMTEXT NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  attempts INT NOT NULL DEFAULT 0,
+  max_attempts INT NOT NULL DEFAULT 8,
+  next_attempt_at DATETIME NULL,
+  last_error TEXT,
+  delivered_at DATETIME NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  KEY idx_task_id (task_id),
+  KEY idx_status_next_attempt (status, next_attempt_at)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  delivery_id BIGINT NOT NULL,
+  attempt INT NOT NULL,
+  status_code INT NOT NULL DEFAULT 0,
+  error TEXT,
+  duration_ms BIGINT NOT NULL DEFAULT 0,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  KEY idx_delivery_id (delivery_id)
+);
+
+CREATE TABLE IF NOT EXISTS task_executions (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  task_id VARCHAR(255) NOT NULL,
+  kind VARCHAR(20) NOT NULL,
+  step_id VARCHAR(255) NOT NULL DEFAULT '',
+  name VARCHAR(255) NOT NULL,
+  action VARCHAR(255) NOT NULL DEFAULT '',
+  parameters MEDIUMTEXT,
+  result MEDIUMTEXT,
+  success BOOLEAN NOT NULL DEFAULT FALSE,
+  error TEXT,
+  started_at DATETIME(3) NOT NULL,
+  duration_ms BIGINT NOT NULL DEFAULT 0,
+  KEY idx_task_kind_id (task_id, kind, id)
+);
+
+CREATE TABLE IF NOT EXISTS assets (
+  id VARCHAR(64) PRIMARY KEY,
+  kind VARCHAR(16) NOT NULL,
+  mime_type VARCHAR(100) NOT NULL,
+  size BIGINT NOT NULL,
+  original_name VARCHAR(255) NOT NULL DEFAULT '',
+  path VARCHAR(1024) NOT NULL,
+  url VARCHAR(2048),
   created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
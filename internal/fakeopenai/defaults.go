@@ -0,0 +1,76 @@
+package fakeopenai
+
+import "fmt"
+
+// DefaultScript is returned for script-model requests when no chat response
+// is queued.
+const DefaultScript = `{
+  "title": "Fake Video",
+  "style": "documentary",
+  "shots": [
+    {
+      "scene": "Opening",
+      "image_prompt": "A sunrise over a quiet city skyline",
+      "voiceover": "Every day starts with a single light.",
+      "duration": 2,
+      "subtitle": "Every day starts with a single light."
+    },
+    {
+      "scene": "Closing",
+      "image_prompt": "The same skyline glowing at night",
+      "voiceover": "And ends with thousands of them.",
+      "duration": 2,
+      "subtitle": "And ends with thousands of them."
+    }
+  ],
+  "bgm": "Soft ambient piano"
+}`
+
+// DefaultPlan is returned for planning-model requests when no chat response
+// is queued.
+const DefaultPlan = `{
+  "task_analysis": "Short narrated video",
+  "strategy": "Script, assets, render",
+  "steps": [
+    {"step_id": "step_1", "agent_name": "ScriptGenerator", "action": "generate_script", "parameters": {}},
+    {"step_id": "step_2", "agent_name": "ImageGenerator", "action": "generate_images", "parameters": {}, "dependency": ["step_1"]},
+    {"step_id": "step_3", "agent_name": "VoiceGenerator", "action": "generate_voice", "parameters": {}, "dependency": ["step_1"]},
+    {"step_id": "step_4", "agent_name": "VideoRender", "action": "render_video", "parameters": {}, "dependency": ["step_2", "step_3"]}
+  ],
+  "reasoning": "Deterministic plan from the fake server"
+}`
+
+// DefaultToolSequence is the order in which tools are called for tool-model
+// requests when no chat response is queued. The n-th call is made once the
+// conversation holds n-1 tool results; after the last one the model answers
+// with plain content.
+var DefaultToolSequence = []ToolCall{
+	{Name: "analyze_content", Arguments: `{"user_text":"fake request"}`},
+	{Name: "generate_script", Arguments: `{"content_type":"educational","target_audience":"general"}`},
+	{Name: "generate_images", Arguments: `{"prompts":["A sunrise over a quiet city skyline","The same skyline glowing at night"]}`},
+	{Name: "generate_voice", Arguments: `{"text":"Every day starts with a single light.","shot_index":0}`},
+	{Name: "generate_voice", Arguments: `{"text":"And ends with thousands of them.","shot_index":1}`},
+	{Name: "render_video", Arguments: `{"script":{}}`},
+}
+
+func defaultChatResponse(req chatRequest) ChatResponse {
+	switch {
+	case len(req.Tools) > 0 || req.Model == ToolModel:
+		toolResults := 0
+		for _, msg := range req.Messages {
+			if msg.Role == "tool" {
+				toolResults++
+			}
+		}
+		if toolResults >= len(DefaultToolSequence) {
+			return ChatResponse{Content: "The video has been created."}
+		}
+		call := DefaultToolSequence[toolResults]
+		call.ID = fmt.Sprintf("call_%d", toolResults+1)
+		return ChatResponse{ToolCalls: []ToolCall{call}}
+	case req.Model == PlanningModel:
+		return ChatResponse{Content: DefaultPlan}
+	default:
+		return ChatResponse{Content: DefaultScript}
+	}
+}
@@ -0,0 +1,303 @@
+// Package fakeopenai serves deterministic, scripted OpenAI-compatible
+// responses on localhost so the video pipeline can run without network
+// access or a real API key.
+//
+// Typical use in a test:
+//
+//	srv := fakeopenai.New()
+//	defer srv.Close()
+//	config.AppConfig = srv.Config()
+//	agent.SetLLMProvider(nil) // rebuild the provider from the new config
+//
+// Chat completions are answered from a FIFO queue filled with EnqueueChat.
+// When the queue is empty a default answer is chosen from the requested
+// model: a two-shot script, a four-step execution plan, or the next call of
+// a fixed tool sequence ending in render_video.
+package fakeopenai
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"video-agent-go/config"
+)
+
+// Model names reported by Config, used to pick default answers.
+const (
+	ScriptModel   = "fake-script"
+	PlanningModel = "fake-planning"
+	ToolModel     = "fake-tools"
+)
+
+// ChatResponse is one scripted answer to /v1/chat/completions.
+type ChatResponse struct {
+	Content   string
+	ToolCalls []ToolCall
+	// Status, when non-zero and not 200, makes the server answer with an
+	// OpenAI-style error body instead of a completion.
+	Status int
+}
+
+// ToolCall is a scripted function call. Arguments is sent verbatim as the
+// JSON-encoded string the real API uses.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// RecordedRequest is a request the server received.
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Body   []byte
+}
+
+// Server is a running fake OpenAI endpoint.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	chat     []ChatResponse
+	failures map[string][]int
+	requests []RecordedRequest
+}
+
+// New starts a fake server on a random localhost port.
+func New() *Server {
+	s := &Server{failures: make(map[string][]int)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", s.handleChat)
+	mux.HandleFunc("/v1/images/generations", s.handleImages)
+	mux.HandleFunc("/v1/audio/speech", s.handleSpeech)
+	mux.HandleFunc("/files/image.png", s.handleImageFile)
+
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// BaseURL is the OpenAI-compatible API root, e.g. http://127.0.0.1:1234/v1.
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// APIConfig points every provider call at this server.
+func (s *Server) APIConfig() config.APIConfig {
+	return config.APIConfig{
+		OpenAIKey:      "sk-fake",
+		OpenAIBaseURL:  s.BaseURL(),
+		ScriptModel:    ScriptModel,
+		PlanningModel:  PlanningModel,
+		ToolModel:      ToolModel,
+		LLMTimeout:     10 * time.Second,
+		MediaTimeout:   10 * time.Second,
+		LLMDeadline:    30 * time.Second,
+		MediaDeadline:  30 * time.Second,
+		MaxRetries:     3,
+		RetryBaseDelay: 10 * time.Millisecond,
+		RetryMaxDelay:  100 * time.Millisecond,
+	}
+}
+
+// Config returns an application config that uses this server and local
+// storage, suitable for assigning to config.AppConfig. Everything else has
+// the defaults from config.Default.
+func (s *Server) Config() *config.Config {
+	cfg := config.Default()
+	cfg.API = s.APIConfig()
+	cfg.Storage.Type = "local"
+	return cfg
+}
+
+// EnqueueChat appends scripted chat completions, served in order.
+func (s *Server) EnqueueChat(responses ...ChatResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chat = append(s.chat, responses...)
+}
+
+// FailNext makes the next len(statuses) requests to path answer with the
+// given HTTP statuses, e.g. FailNext("/v1/audio/speech", 429, 500).
+func (s *Server) FailNext(path string, statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[path] = append(s.failures[path], statuses...)
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]RecordedRequest(nil), s.requests...)
+}
+
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, RecordedRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+		var status int
+		if queued := s.failures[r.URL.Path]; len(queued) > 0 {
+			status, s.failures[r.URL.Path] = queued[0], queued[1:]
+		}
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	Tools []json.RawMessage `json:"tools"`
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	var resp ChatResponse
+	if len(s.chat) > 0 {
+		resp, s.chat = s.chat[0], s.chat[1:]
+	} else {
+		resp = defaultChatResponse(req)
+	}
+	s.mu.Unlock()
+
+	if resp.Status != 0 && resp.Status != http.StatusOK {
+		writeError(w, resp.Status)
+		return
+	}
+
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": resp.Content,
+	}
+	finishReason := "stop"
+	if len(resp.ToolCalls) > 0 {
+		calls := make([]map[string]interface{}, 0, len(resp.ToolCalls))
+		for _, call := range resp.ToolCalls {
+			calls = append(calls, map[string]interface{}{
+				"id":   call.ID,
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      call.Name,
+					"arguments": call.Arguments,
+				},
+			})
+		}
+		message["content"] = nil
+		message["tool_calls"] = calls
+		finishReason = "tool_calls"
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"id":      "chatcmpl-fake",
+		"object":  "chat.completion",
+		"created": 0,
+		"model":   req.Model,
+		"choices": []map[string]interface{}{
+			{"index": 0, "message": message, "finish_reason": finishReason},
+		},
+		"usage": map[string]int{"prompt_tokens": 0, "completion_tokens": 0, "total_tokens": 0},
+	})
+}
+
+func (s *Server) handleImages(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"created": 0,
+		"data":    []map[string]string{{"url": s.URL + "/files/image.png"}},
+	})
+}
+
+func (s *Server) handleImageFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(testImage)
+}
+
+func (s *Server) handleSpeech(w http.ResponseWriter, r *http.Request) {
+	// The real API returns mp3; a WAV body is still decoded by ffmpeg,
+	// which probes content rather than trusting the file extension.
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Write(silentWAV)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "0")
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": fmt.Sprintf("fake error %d", status),
+			"type":    http.StatusText(status),
+		},
+	})
+}
+
+var (
+	testImage = func() []byte {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+			}
+		}
+		var buf bytes.Buffer
+		png.Encode(&buf, img)
+		return buf.Bytes()
+	}()
+
+	// silentWAV is one second of 8kHz mono 16-bit silence.
+	silentWAV = func() []byte {
+		const sampleRate, samples = 8000, 8000
+		var buf bytes.Buffer
+		buf.WriteString("RIFF")
+		binary.Write(&buf, binary.LittleEndian, uint32(36+samples*2))
+		buf.WriteString("WAVEfmt ")
+		binary.Write(&buf, binary.LittleEndian, uint32(16))
+		binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+		binary.Write(&buf, binary.LittleEndian, uint16(1)) // mono
+		binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+		binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+		binary.Write(&buf, binary.LittleEndian, uint16(2))
+		binary.Write(&buf, binary.LittleEndian, uint16(16))
+		buf.WriteString("data")
+		binary.Write(&buf, binary.LittleEndian, uint32(samples*2))
+		buf.Write(make([]byte, samples*2))
+		return buf.Bytes()
+	}()
+)
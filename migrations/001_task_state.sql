@@ -0,0 +1,46 @@
+-- Upgrades a video_tasks table created before task state was persisted
+-- (status, stage, progress, error, mode, updated_at). New installs get the
+-- same schema from init.sql. Safe to run more than once:
+--
+--   mysql video_agent < init.sql
+--   mysql video_agent < migrations/001_task_state.sql
+
+DROP PROCEDURE IF EXISTS migrate_task_state;
+
+DELIMITER //
+
+CREATE PROCEDURE migrate_task_state()
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM information_schema.COLUMNS
+                 WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'video_tasks' AND COLUMN_NAME = 'status') THEN
+    ALTER TABLE video_tasks
+      ADD COLUMN status VARCHAR(32) NOT NULL DEFAULT 'pending' AFTER output,
+      ADD COLUMN stage VARCHAR(64) NOT NULL DEFAULT '' AFTER status,
+      ADD COLUMN progress INT NOT NULL DEFAULT 0 AFTER stage,
+      ADD COLUMN error TEXT AFTER progress,
+      ADD COLUMN mode VARCHAR(32) NOT NULL DEFAULT 'fixed' AFTER error,
+      ADD COLUMN updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP AFTER created_at;
+
+    -- Existing tasks with an output finished; the rest were never queued as
+    -- jobs and can only be run again through the retry endpoint
+    UPDATE video_tasks SET status = 'completed', stage = 'done', progress = 100
+      WHERE output IS NOT NULL AND output <> '';
+    UPDATE video_tasks SET status = 'failed', error = 'interrupted by the task state upgrade'
+      WHERE status = 'pending';
+  END IF;
+
+  IF NOT EXISTS (SELECT 1 FROM information_schema.STATISTICS
+                 WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'video_tasks' AND INDEX_NAME = 'uk_task_id') THEN
+    ALTER TABLE video_tasks ADD UNIQUE KEY uk_task_id (task_id);
+  END IF;
+
+  IF NOT EXISTS (SELECT 1 FROM information_schema.STATISTICS
+                 WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'video_tasks' AND INDEX_NAME = 'idx_status') THEN
+    ALTER TABLE video_tasks ADD KEY idx_status (status);
+  END IF;
+END //
+
+DELIMITER ;
+
+CALL migrate_task_state();
+DROP PROCEDURE migrate_task_state;
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"video-agent-go/netguard"
+)
+
+// AssetKind 上传素材的类型
+type AssetKind string
+
+const (
+	AssetImage AssetKind = "image"
+	AssetAudio AssetKind = "audio"
+	AssetVideo AssetKind = "video"
+)
+
+// AssetIDPrefix 素材ID的前缀，UserInput 的媒体字段中以此开头的值会被解析为本地文件
+const AssetIDPrefix = "asset_"
+
+// Asset 用户上传的素材文件
+type Asset struct {
+	ID           string    `json:"id"`
+	Kind         AssetKind `json:"kind"`
+	MimeType     string    `json:"mime_type"`
+	Size         int64     `json:"size"`
+	OriginalName string    `json:"original_name"`
+	Path         string    `json:"-"` // 本地路径，只在服务端使用
+	URL          string    `json:"url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AssetError 请求引用的素材不存在或类型不符
+type AssetError struct {
+	ID     string
+	Reason string
+}
+
+func (e *AssetError) Error() string {
+	return fmt.Sprintf("asset %s %s", e.ID, e.Reason)
+}
+
+// SaveAsset 记录已写入存储的素材
+func SaveAsset(asset *Asset) error {
+	query := `INSERT INTO assets (id, kind, mime_type, size, original_name, path, url, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW())`
+	_, err := DB.Exec(query, asset.ID, asset.Kind, asset.MimeType, asset.Size, asset.OriginalName, asset.Path, asset.URL)
+	return err
+}
+
+// GetAsset 读取素材记录
+func GetAsset(id string) (*Asset, error) {
+	query := `SELECT id, kind, mime_type, size, original_name, path, COALESCE(url, ''), created_at FROM assets WHERE id = ?`
+	var asset Asset
+	err := DB.QueryRow(query, id).Scan(&asset.ID, &asset.Kind, &asset.MimeType, &asset.Size,
+		&asset.OriginalName, &asset.Path, &asset.URL, &asset.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// IsAssetID 判断媒体字段的值是否引用上传的素材
+func IsAssetID(value string) bool {
+	return strings.HasPrefix(value, AssetIDPrefix)
+}
+
+// ResolveAssets 把 Images、Audio、Video 中引用的素材ID替换为本地路径，公网 http(s) 地址保持不变。
+// 素材不存在或类型不符时返回 AssetError；其他值（服务端路径、内网地址等）不允许引用，返回 FieldError
+func ResolveAssets(input *UserInput) error {
+	images := make([]string, len(input.Images))
+	for i, image := range input.Images {
+		path, err := resolveAsset(fmt.Sprintf("images[%d]", i), image, AssetImage)
+		if err != nil {
+			return err
+		}
+		images[i] = path
+	}
+
+	audio, err := resolveAsset("audio", input.Audio, AssetAudio)
+	if err != nil {
+		return err
+	}
+	video, err := resolveAsset("video", input.Video, AssetVideo)
+	if err != nil {
+		return err
+	}
+
+	input.Images, input.Audio, input.Video = images, audio, video
+	return nil
+}
+
+func resolveAsset(field, value string, kind AssetKind) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if !IsAssetID(value) {
+		if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			return "", FieldError{Field: field, Message: "must be an uploaded asset ID or an http(s) URL"}
+		}
+		if err := netguard.ValidateURL(value); err != nil {
+			return "", FieldError{Field: field, Message: "URL " + err.Error()}
+		}
+		return value, nil
+	}
+
+	asset, err := GetAsset(value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", &AssetError{ID: value, Reason: "not found"}
+	}
+	if err != nil {
+		return "", err
+	}
+	if asset.Kind != kind {
+		return "", &AssetError{ID: value, Reason: fmt.Sprintf("is %s, expected %s", asset.Kind, kind)}
+	}
+	return asset.Path, nil
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveAssetsRejectsNonURLs(t *testing.T) {
+	tests := []struct {
+		input UserInput
+		field string
+	}{
+		{UserInput{Images: []string{"https://8.8.8.8/a.png", "/etc/passwd"}}, "images[1]"},
+		{UserInput{Audio: "../tasks/other/narration.mp3"}, "audio"},
+		{UserInput{Video: "file:///var/lib/video.mp4"}, "video"},
+		{UserInput{Video: "http://127.0.0.1:8080/video.mp4"}, "video"},
+		{UserInput{Images: []string{"http://169.254.169.254/latest/meta-data/"}}, "images[0]"},
+	}
+	for _, tt := range tests {
+		err := ResolveAssets(&tt.input)
+		var fieldErr FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field {
+			t.Errorf("ResolveAssets(%+v) = %v, want a %s field error", tt.input, err, tt.field)
+		}
+	}
+}
+
+func TestResolveAssetsKeepsPublicURLs(t *testing.T) {
+	input := UserInput{Images: []string{"https://8.8.8.8/a.png"}, Video: "http://1.1.1.1/v.mp4"}
+	if err := ResolveAssets(&input); err != nil {
+		t.Fatal(err)
+	}
+	if input.Images[0] != "https://8.8.8.8/a.png" || input.Video != "http://1.1.1.1/v.mp4" || input.Audio != "" {
+		t.Errorf("got %+v, want the URLs unchanged", input)
+	}
+}
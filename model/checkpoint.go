@@ -0,0 +1,173 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// CheckpointKind 检查点对应的处理阶段
+type CheckpointKind string
+
+const (
+	CheckpointScript CheckpointKind = "script" // 生成的脚本JSON
+	CheckpointImage  CheckpointKind = "image"  // 单个镜头的图像路径
+	CheckpointVoice  CheckpointKind = "voice"  // 单个镜头的配音路径
+	CheckpointClip   CheckpointKind = "clip"   // 单个镜头渲染好的视频片段
+)
+
+// scriptShotIndex 脚本检查点不属于任何镜头
+const scriptShotIndex = -1
+
+// Checkpoint 任务某个阶段已完成的产物
+type Checkpoint struct {
+	TaskID    string         `json:"task_id"`
+	Kind      CheckpointKind `json:"kind"`
+	ShotIndex int            `json:"shot_index"`
+	Value     string         `json:"value"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// SaveCheckpoint 记录镜头级产物，同一镜头同一阶段只保留最新的一份
+func SaveCheckpoint(taskID string, kind CheckpointKind, shotIndex int, value string) error {
+	query := `INSERT INTO task_checkpoints (task_id, kind, shot_index, value, updated_at)
+		VALUES (?, ?, ?, ?, NOW(6))
+		ON DUPLICATE KEY UPDATE value = VALUES(value), updated_at = NOW(6)`
+	_, err := DB.Exec(query, taskID, kind, shotIndex, value)
+	return err
+}
+
+// SaveScriptCheckpoint 记录生成的脚本，素材路径另行记录
+func SaveScriptCheckpoint(taskID string, script *ScriptOutput) error {
+	data, err := scriptCheckpointValue(script)
+	if err != nil {
+		return err
+	}
+	return SaveCheckpoint(taskID, CheckpointScript, scriptShotIndex, data)
+}
+
+// scriptCheckpointValue 去掉生成的素材路径后序列化脚本。剪辑镜头的 ClipPath 是脚本生成时
+// 指定的源视频，不是生成的素材，需要保留，否则重试时会被当作缺少图像的镜头
+func scriptCheckpointValue(script *ScriptOutput) (string, error) {
+	bare := *script
+	bare.Shots = make([]Shot, len(script.Shots))
+	for i, shot := range script.Shots {
+		if !shot.HasSource() {
+			shot.ClipPath = ""
+		}
+		shot.VoicePath, shot.RenderedClip = "", ""
+		bare.Shots[i] = shot
+	}
+	bare.Final, bare.TaskID, bare.Status = "", "", ""
+
+	data, err := json.Marshal(bare)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GetCheckpoints 读取任务的全部检查点
+func GetCheckpoints(taskID string) ([]Checkpoint, error) {
+	query := `SELECT task_id, kind, shot_index, value, updated_at FROM task_checkpoints
+		WHERE task_id = ? ORDER BY shot_index, kind`
+	rows, err := DB.Query(query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []Checkpoint
+	for rows.Next() {
+		var cp Checkpoint
+		if err := rows.Scan(&cp.TaskID, &cp.Kind, &cp.ShotIndex, &cp.Value, &cp.UpdatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
+
+// LoadResumeScript 用检查点还原上次执行到的脚本和素材路径，没有脚本检查点时返回 nil, nil。
+// 片段只有在晚于对应镜头的图像和配音生成时才会复用，否则说明素材已更新，需要重新渲染
+func LoadResumeScript(taskID string) (*ScriptOutput, error) {
+	checkpoints, err := GetCheckpoints(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	var script *ScriptOutput
+	byShot := make(map[int]map[CheckpointKind]Checkpoint)
+	for _, cp := range checkpoints {
+		if cp.Kind == CheckpointScript {
+			script = &ScriptOutput{}
+			if err := json.Unmarshal([]byte(cp.Value), script); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if byShot[cp.ShotIndex] == nil {
+			byShot[cp.ShotIndex] = make(map[CheckpointKind]Checkpoint)
+		}
+		byShot[cp.ShotIndex][cp.Kind] = cp
+	}
+	if script == nil {
+		return nil, nil
+	}
+
+	for i := range script.Shots {
+		shot := &script.Shots[i]
+		kinds := byShot[i]
+		image, hasImage := kinds[CheckpointImage]
+		voice, hasVoice := kinds[CheckpointVoice]
+		if hasImage {
+			shot.ClipPath = image.Value
+		}
+		if hasVoice {
+			shot.VoicePath = voice.Value
+		}
+		if clip, ok := kinds[CheckpointClip]; ok &&
+			!clip.UpdatedAt.Before(image.UpdatedAt) && !clip.UpdatedAt.Before(voice.UpdatedAt) {
+			shot.RenderedClip = clip.Value
+		}
+	}
+
+	return script, nil
+}
+
+// ErrAlreadyRetried 并发的重试请求已经把任务重新排队
+var ErrAlreadyRetried = errors.New("task was already re-queued by another retry")
+
+// RetryTask 把失败的任务重新排队，已有检查点的阶段不会重新执行
+func RetryTask(taskID string) error {
+	task, err := GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	if !task.Status.CanTransitionTo(TaskStatePending) {
+		return &TransitionError{TaskID: taskID, From: task.Status, To: TaskStatePending}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE video_tasks SET status = ?, error = '', updated_at = NOW() WHERE task_id = ? AND status = ?`
+	result, err := tx.Exec(query, TaskStatePending, taskID, task.Status)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		// 并发的重试请求已经抢先重新排队
+		return ErrAlreadyRetried
+	}
+
+	if err := insertJob(tx, taskID, task.Mode); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestScriptCheckpointValue(t *testing.T) {
+	script := &ScriptOutput{
+		Title: "Edit",
+		Shots: []Shot{
+			{ImagePrompt: "A skyline", ClipPath: "uploads/images/a.png", VoicePath: "uploads/audio/a.mp3", RenderedClip: "temp/clip_0.mp4"},
+			{SourceStart: 2, SourceEnd: 6, ClipPath: "uploads/videos/source.mp4", VoicePath: "uploads/audio/b.mp3"},
+		},
+		Final:  "uploads/videos/final.mp4",
+		TaskID: "task",
+		Status: "completed",
+	}
+
+	value, err := scriptCheckpointValue(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved ScriptOutput
+	if err := json.Unmarshal([]byte(value), &saved); err != nil {
+		t.Fatalf("invalid checkpoint %s: %v", value, err)
+	}
+
+	if generated := saved.Shots[0]; generated.ClipPath != "" || generated.VoicePath != "" || generated.RenderedClip != "" {
+		t.Errorf("generated shot kept its assets: %+v", generated)
+	}
+	if source := saved.Shots[1]; source.ClipPath != "uploads/videos/source.mp4" || !source.HasSource() {
+		t.Errorf("source shot lost its source video: %+v", source)
+	}
+	if saved.Shots[1].VoicePath != "" {
+		t.Errorf("source shot kept its voice %q", saved.Shots[1].VoicePath)
+	}
+	if saved.Final != "" || saved.TaskID != "" || saved.Status != "" {
+		t.Errorf("checkpoint kept the task result: %+v", saved)
+	}
+	if script.Shots[0].ClipPath == "" {
+		t.Error("checkpointing modified the live script")
+	}
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// TaskEventType 任务事件类型
+type TaskEventType string
+
+const (
+	EventStatus    TaskEventType = "status"     // 状态或进度变化
+	EventToolCall  TaskEventType = "tool_call"  // Tool-based 编排中的一次工具调用
+	EventAgentStep TaskEventType = "agent_step" // LLM Agent 编排中的一个执行步骤
+)
+
+// TaskEvent 任务执行过程中的一条事件，按ID递增的顺序推送给订阅者
+type TaskEvent struct {
+	ID        int64         `json:"id"`
+	TaskID    string        `json:"task_id"`
+	Type      TaskEventType `json:"type"`
+	Status    string        `json:"status,omitempty"`
+	Progress  int           `json:"progress"`
+	Message   string        `json:"message,omitempty"`
+	Data      interface{}   `json:"data,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// IsFinished 事件表示任务停止执行：完成、取消或失败。失败的任务重试后还会有新事件
+func (e TaskEvent) IsFinished() bool {
+	return e.Type == EventStatus && TaskState(e.Status).IsFinished()
+}
+
+// SaveTaskEvent 持久化事件并回填ID
+func SaveTaskEvent(event *TaskEvent) error {
+	data, err := marshalNullable(event.Data)
+	if err != nil {
+		return err
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO task_events (task_id, type, status, progress, message, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := DB.Exec(query, event.TaskID, event.Type, event.Status, event.Progress, event.Message, data, event.CreatedAt)
+	if err != nil {
+		return err
+	}
+	event.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListTaskEvents 读取ID大于afterID的事件，最多limit条
+func ListTaskEvents(taskID string, afterID int64, limit int) ([]TaskEvent, error) {
+	query := `SELECT id, task_id, type, status, progress, COALESCE(message, ''), data, created_at
+		FROM task_events WHERE task_id = ? AND id > ? ORDER BY id LIMIT ?`
+	rows, err := DB.Query(query, taskID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []TaskEvent
+	for rows.Next() {
+		var event TaskEvent
+		var data sql.NullString
+		err := rows.Scan(&event.ID, &event.TaskID, &event.Type, &event.Status, &event.Progress,
+			&event.Message, &data, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if data.Valid {
+			event.Data = json.RawMessage(data.String)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ExecutionKind 执行记录的类型
+type ExecutionKind string
+
+const (
+	ExecutionAgentStep ExecutionKind = "agent_step" // LLM Agent 编排中的一个步骤
+	ExecutionToolCall  ExecutionKind = "tool_call"  // Tool-based 编排中的一次工具调用
+)
+
+// ExecutionRecord 编排过程中的一次智能体执行或工具调用，构成任务的可审计执行轨迹
+type ExecutionRecord struct {
+	ID         int64         `json:"id"`
+	TaskID     string        `json:"task_id"`
+	Kind       ExecutionKind `json:"kind"`
+	StepID     string        `json:"step_id"` // 规划步骤ID或工具调用ID
+	Name       string        `json:"name"`    // 智能体名或工具名
+	Action     string        `json:"action,omitempty"`
+	Parameters interface{}   `json:"parameters,omitempty"`
+	Result     interface{}   `json:"result,omitempty"`
+	Success    bool          `json:"success"`
+	Error      string        `json:"error,omitempty"`
+	StartedAt  time.Time     `json:"started_at"`
+	DurationMs int64         `json:"duration_ms"`
+}
+
+// SaveExecutionRecord 写入一条执行记录并回填ID
+func SaveExecutionRecord(record *ExecutionRecord) error {
+	parameters, err := marshalNullable(record.Parameters)
+	if err != nil {
+		return err
+	}
+	result, err := marshalNullable(record.Result)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO task_executions (task_id, kind, step_id, name, action, parameters, result, success, error,
+		started_at, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := DB.Exec(query, record.TaskID, record.Kind, record.StepID, record.Name, record.Action,
+		parameters, result, record.Success, record.Error, record.StartedAt, record.DurationMs)
+	if err != nil {
+		return err
+	}
+	record.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListExecutionRecords 按执行顺序分页读取任务某一类型的执行记录，同时返回总数
+func ListExecutionRecords(taskID string, kind ExecutionKind, offset, limit int) ([]ExecutionRecord, int, error) {
+	var total int
+	countQuery := `SELECT COUNT(*) FROM task_executions WHERE task_id = ? AND kind = ?`
+	if err := DB.QueryRow(countQuery, taskID, kind).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, task_id, kind, step_id, name, action, parameters, result, success, COALESCE(error, ''),
+		started_at, duration_ms FROM task_executions WHERE task_id = ? AND kind = ? ORDER BY id LIMIT ? OFFSET ?`
+	rows, err := DB.Query(query, taskID, kind, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	records := make([]ExecutionRecord, 0)
+	for rows.Next() {
+		var record ExecutionRecord
+		var parameters, result sql.NullString
+		err := rows.Scan(&record.ID, &record.TaskID, &record.Kind, &record.StepID, &record.Name, &record.Action,
+			&parameters, &result, &record.Success, &record.Error, &record.StartedAt, &record.DurationMs)
+		if err != nil {
+			return nil, 0, err
+		}
+		if parameters.Valid {
+			record.Parameters = json.RawMessage(parameters.String)
+		}
+		if result.Valid {
+			record.Result = json.RawMessage(result.String)
+		}
+		records = append(records, record)
+	}
+	return records, total, rows.Err()
+}
+
+func marshalNullable(v interface{}) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
@@ -0,0 +1,210 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// JobStatus 队列中任务作业的状态
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"  // 等待worker领取
+	JobRunning JobStatus = "running" // 已被worker租用
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// defaultJobMaxAttempts 租约过期后最多重新入队的次数（包括第一次执行）
+const defaultJobMaxAttempts = 3
+
+// ErrLeaseLost 作业的租约已过期或被其他worker接管
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Job 队列中的一个作业，JobType 即任务的处理模式
+type Job struct {
+	ID             int64      `json:"id"`
+	TaskID         string     `json:"task_id"`
+	JobType        TaskMode   `json:"job_type"`
+	Status         JobStatus  `json:"status"`
+	Attempts       int        `json:"attempts"`
+	MaxAttempts    int        `json:"max_attempts"`
+	WorkerID       string     `json:"worker_id"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertJob(db execer, taskID string, jobType TaskMode) error {
+	query := `INSERT INTO video_jobs (task_id, job_type, status, attempts, max_attempts, worker_id, created_at, updated_at)
+		VALUES (?, ?, ?, 0, ?, '', NOW(), NOW())`
+	_, err := db.Exec(query, taskID, jobType, JobQueued, defaultJobMaxAttempts)
+	return err
+}
+
+// EnqueueJob 把任务加入作业队列
+func EnqueueJob(taskID string, jobType TaskMode) error {
+	return insertJob(DB, taskID, jobType)
+}
+
+// LeaseJob 领取最早入队的作业并持有lease时长的租约，队列为空时返回 nil, nil
+func LeaseJob(workerID string, lease time.Duration) (*Job, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED 让多个worker并发领取时互不阻塞
+	query := `SELECT id FROM video_jobs WHERE status = ? ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED`
+	var id int64
+	if err := tx.QueryRow(query, JobQueued).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	update := `UPDATE video_jobs SET status = ?, worker_id = ?, attempts = attempts + 1,
+		lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND), updated_at = NOW() WHERE id = ?`
+	if _, err := tx.Exec(update, JobRunning, workerID, leaseSeconds(lease), id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetJob(id)
+}
+
+// HeartbeatJob 延长worker持有的租约，租约已丢失时返回 ErrLeaseLost
+func HeartbeatJob(jobID int64, workerID string, lease time.Duration) error {
+	query := `UPDATE video_jobs SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND), updated_at = NOW()
+		WHERE id = ? AND worker_id = ? AND status = ?`
+	return expectLeased(DB.Exec(query, leaseSeconds(lease), jobID, workerID, JobRunning))
+}
+
+// CompleteJob 标记作业执行完成
+func CompleteJob(jobID int64, workerID string) error {
+	query := `UPDATE video_jobs SET status = ?, lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = ? AND worker_id = ? AND status = ?`
+	return expectLeased(DB.Exec(query, JobDone, jobID, workerID, JobRunning))
+}
+
+// FailJob 标记作业执行失败并记录错误
+func FailJob(jobID int64, workerID string, cause error) error {
+	query := `UPDATE video_jobs SET status = ?, last_error = ?, lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = ? AND worker_id = ? AND status = ?`
+	return expectLeased(DB.Exec(query, JobFailed, cause.Error(), jobID, workerID, JobRunning))
+}
+
+// ReapExpiredJobs 处理租约过期的作业：还有剩余次数的重新入队，
+// 次数用尽的标记为失败并返回对应的任务ID。过期作业在同一事务中加锁后再更新，
+// 并发的回收或迟到的心跳不会让同一个作业被处理两次
+func ReapExpiredJobs() (requeued int64, abandoned []string, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED 跳过其他回收者或心跳正在更新的作业，下一轮再检查
+	query := `SELECT id, task_id, attempts >= max_attempts FROM video_jobs
+		WHERE status = ? AND lease_expires_at < NOW() FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(query, JobRunning)
+	if err != nil {
+		return 0, nil, err
+	}
+	var failIDs, requeueIDs []interface{}
+	for rows.Next() {
+		var id int64
+		var taskID string
+		var exhausted bool
+		if err := rows.Scan(&id, &taskID, &exhausted); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		if exhausted {
+			failIDs = append(failIDs, id)
+			abandoned = append(abandoned, taskID)
+		} else {
+			requeueIDs = append(requeueIDs, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	if len(failIDs) > 0 {
+		fail := `UPDATE video_jobs SET status = ?, last_error = 'lease expired', lease_expires_at = NULL, updated_at = NOW()
+			WHERE id IN (` + placeholders(len(failIDs)) + `)`
+		if _, err := tx.Exec(fail, append([]interface{}{JobFailed}, failIDs...)...); err != nil {
+			return 0, nil, err
+		}
+	}
+	if len(requeueIDs) > 0 {
+		requeue := `UPDATE video_jobs SET status = ?, worker_id = '', lease_expires_at = NULL, last_error = 'lease expired', updated_at = NOW()
+			WHERE id IN (` + placeholders(len(requeueIDs)) + `)`
+		if _, err := tx.Exec(requeue, append([]interface{}{JobQueued}, requeueIDs...)...); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return int64(len(requeueIDs)), abandoned, nil
+}
+
+// GetJob 按ID读取作业
+func GetJob(jobID int64) (*Job, error) {
+	query := `SELECT id, task_id, job_type, status, attempts, max_attempts, worker_id, lease_expires_at,
+		COALESCE(last_error, ''), created_at, updated_at FROM video_jobs WHERE id = ?`
+
+	var job Job
+	var leaseExpiresAt sql.NullTime
+	err := DB.QueryRow(query, jobID).Scan(&job.ID, &job.TaskID, &job.JobType, &job.Status, &job.Attempts,
+		&job.MaxAttempts, &job.WorkerID, &leaseExpiresAt, &job.LastError, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if leaseExpiresAt.Valid {
+		job.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+	return &job, nil
+}
+
+func expectLeased(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// placeholders 返回 IN 子句使用的n个占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func leaseSeconds(lease time.Duration) int {
+	seconds := int(lease / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -38,27 +38,50 @@ func InitDB() {
 	log.Println("Database connected successfully")
 }
 
-func SaveTask(taskID, input, output string) error {
-	query := `INSERT INTO video_tasks (task_id, input, output, created_at) VALUES (?, ?, ?, NOW())`
-	_, err := DB.Exec(query, taskID, input, output)
-	return err
-}
+const taskColumns = `id, task_id, COALESCE(input, ''), COALESCE(output, ''), status, stage, progress,
+	COALESCE(error, ''), mode, created_at, updated_at`
 
-func GetTask(taskID string) (*VideoTask, error) {
-	query := `SELECT id, task_id, input, output, created_at FROM video_tasks WHERE task_id = ?`
-	row := DB.QueryRow(query, taskID)
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+func scanTask(row rowScanner) (*VideoTask, error) {
 	var task VideoTask
-	err := row.Scan(&task.ID, &task.TaskID, &task.Input, &task.Output, &task.CreatedAt)
+	err := row.Scan(&task.ID, &task.TaskID, &task.Input, &task.Output, &task.Status, &task.Stage,
+		&task.Progress, &task.Error, &task.Mode, &task.CreatedAt, &task.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-
 	return &task, nil
 }
 
+// SaveTask 创建一个待处理的任务，并在同一事务中把它加入作业队列
+func SaveTask(taskID string, mode TaskMode, input string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO video_tasks (task_id, input, output, status, stage, progress, mode, created_at, updated_at)
+		VALUES (?, ?, '', ?, '', 0, ?, NOW(), NOW())`
+	if _, err := tx.Exec(query, taskID, input, TaskStatePending, mode); err != nil {
+		return err
+	}
+	if err := insertJob(tx, taskID, mode); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func GetTask(taskID string) (*VideoTask, error) {
+	query := `SELECT ` + taskColumns + ` FROM video_tasks WHERE task_id = ?`
+	return scanTask(DB.QueryRow(query, taskID))
+}
+
 func GetAllTasks() ([]VideoTask, error) {
-	query := `SELECT id, task_id, input, output, created_at FROM video_tasks ORDER BY created_at DESC`
+	query := `SELECT ` + taskColumns + ` FROM video_tasks ORDER BY created_at DESC`
 	rows, err := DB.Query(query)
 	if err != nil {
 		return nil, err
@@ -67,20 +90,137 @@ func GetAllTasks() ([]VideoTask, error) {
 
 	var tasks []VideoTask
 	for rows.Next() {
-		var task VideoTask
-		err := rows.Scan(&task.ID, &task.TaskID, &task.Input, &task.Output, &task.CreatedAt)
+		task, err := scanTask(rows)
 		if err != nil {
 			return nil, err
 		}
-		tasks = append(tasks, task)
+		tasks = append(tasks, *task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// TransitionTask 按状态机迁移任务状态，非法迁移返回 *TransitionError
+func TransitionTask(taskID string, to TaskState, stage string, progress int, errMsg string) error {
+	from := statesLeadingTo(to)
+	if len(from) == 0 {
+		return &TransitionError{TaskID: taskID, To: to}
+	}
+
+	query := `UPDATE video_tasks SET status = ?, stage = ?, progress = ?, error = ?, updated_at = NOW()
+		WHERE task_id = ? AND status IN (` + placeholders(len(from)) + `)`
+
+	args := []interface{}{to, stage, progress, errMsg, taskID}
+	for _, state := range from {
+		args = append(args, state)
+	}
+
+	result, err := DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	return checkTransition(result, taskID, to)
+}
+
+// checkTransition 没有行被更新时，区分任务不存在和状态不允许迁移
+func checkTransition(result sql.Result, taskID string, to TaskState) error {
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+
+	task, err := GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	if task.Status == to {
+		return nil
+	}
+	return &TransitionError{TaskID: taskID, From: task.Status, To: to}
+}
+
+// UpdateTaskProgress 更新处理中任务的阶段和进度
+func UpdateTaskProgress(taskID, stage string, progress int) error {
+	query := `UPDATE video_tasks SET stage = ?, progress = ?, updated_at = NOW() WHERE task_id = ? AND status = ?`
+	_, err := DB.Exec(query, stage, progress, taskID, TaskStateProcessing)
+	return err
+}
+
+// CompleteTask 保存结果并把任务标记为完成
+func CompleteTask(taskID string, output interface{}) error {
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE video_tasks SET output = ?, status = ?, stage = 'done', progress = 100, error = '', updated_at = NOW()
+		WHERE task_id = ? AND status = ?`
+	result, err := DB.Exec(query, string(outputJSON), TaskStateCompleted, taskID, TaskStateProcessing)
+	if err != nil {
+		return err
+	}
+	return checkTransition(result, taskID, TaskStateCompleted)
+}
+
+// FailTask 把任务标记为失败并记录错误
+func FailTask(taskID, stage string, cause error) error {
+	task, err := GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	return TransitionTask(taskID, TaskStateFailed, stage, task.Progress, cause.Error())
+}
+
+// CancelTask 取消未结束的任务，保留当前阶段和进度；排队中的作业一并移出队列，
+// 正在执行的作业由worker发现状态变化后中止
+func CancelTask(taskID string) error {
+	task, err := GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	if err := TransitionTask(taskID, TaskStateCancelled, task.Stage, task.Progress, ""); err != nil {
+		return err
+	}
+
+	query := `UPDATE video_jobs SET status = ?, last_error = 'task cancelled', updated_at = NOW()
+		WHERE task_id = ? AND status = ?`
+	_, err = DB.Exec(query, JobFailed, taskID, JobQueued)
+	return err
+}
+
+// GetTaskStatus 从数据库读取任务的完整状态
+func GetTaskStatus(taskID string) (*ExtendedTaskStatus, error) {
+	task, err := GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ExtendedTaskStatus{
+		TaskID:          task.TaskID,
+		Status:          string(task.Status),
+		Mode:            string(task.Mode),
+		Progress:        task.Progress,
+		CurrentStage:    task.Stage,
+		ProcessingSteps: ProcessingSteps(task.Mode),
+		CreatedAt:       task.CreatedAt,
+		UpdatedAt:       task.UpdatedAt,
+	}
+	if task.Error != "" {
+		status.Errors = []string{task.Error}
+	}
+	if task.Output != "" {
+		var result interface{}
+		if err := json.Unmarshal([]byte(task.Output), &result); err == nil {
+			status.Result = result
+		}
 	}
 
-	return tasks, nil
+	return status, nil
 }
 
 func UpdateTaskOutput(taskID string, output interface{}) error {
 	outputJSON, _ := json.Marshal(output)
-	query := `UPDATE video_tasks SET output = ? WHERE task_id = ?`
+	query := `UPDATE video_tasks SET output = ?, updated_at = NOW() WHERE task_id = ?`
 	_, err := DB.Exec(query, string(outputJSON), taskID)
 	return err
 }
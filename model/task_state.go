@@ -0,0 +1,101 @@
+package model
+
+import "fmt"
+
+// TaskState 持久化在 video_tasks.status 中的任务状态
+type TaskState string
+
+const (
+	TaskStatePending    TaskState = "pending"
+	TaskStateProcessing TaskState = "processing"
+	TaskStateCompleted  TaskState = "completed"
+	TaskStateFailed     TaskState = "failed"
+	TaskStateCancelled  TaskState = "cancelled"
+)
+
+// TaskMode 任务的处理模式
+type TaskMode string
+
+const (
+	TaskModeFixed TaskMode = "fixed" // 固定流程
+	TaskModeSmart TaskMode = "smart" // LLM Agent 编排
+	TaskModeTools TaskMode = "tools" // Tool-based 编排
+)
+
+// taskTransitions 合法的状态迁移：pending → processing → completed/failed/cancelled，
+// 失败的任务可以重新排队，从最后完成的阶段继续
+var taskTransitions = map[TaskState][]TaskState{
+	TaskStatePending:    {TaskStateProcessing, TaskStateFailed, TaskStateCancelled},
+	TaskStateProcessing: {TaskStateCompleted, TaskStateFailed, TaskStateCancelled},
+	TaskStateFailed:     {TaskStatePending},
+}
+
+// CanTransitionTo 判断是否允许从当前状态迁移到next
+func (s TaskState) CanTransitionTo(next TaskState) bool {
+	for _, allowed := range taskTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal 终态不会再发生变化
+func (s TaskState) IsTerminal() bool {
+	return len(taskTransitions[s]) == 0
+}
+
+// IsFinished 任务已停止执行：终态，或失败后尚未重试
+func (s TaskState) IsFinished() bool {
+	return s.IsTerminal() || s == TaskStateFailed
+}
+
+// statesLeadingTo 返回可以迁移到next的所有状态
+func statesLeadingTo(next TaskState) []TaskState {
+	var from []TaskState
+	for state := range taskTransitions {
+		if state.CanTransitionTo(next) {
+			from = append(from, state)
+		}
+	}
+	return from
+}
+
+// TransitionError 非法的状态迁移
+type TransitionError struct {
+	TaskID string
+	From   TaskState
+	To     TaskState
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("task %s cannot transition from %s to %s", e.TaskID, e.From, e.To)
+}
+
+// processingSteps 各模式的处理步骤说明
+var processingSteps = map[TaskMode][]string{
+	TaskModeFixed: {
+		"Generating script",
+		"Generating shot images",
+		"Generating voiceovers",
+		"Rendering video",
+	},
+	TaskModeSmart: {
+		"Analyzing user requirements",
+		"Generating execution plan",
+		"Selecting optimal agents",
+		"Dynamic execution",
+	},
+	TaskModeTools: {
+		"Analyzing user requirements with LLM",
+		"LLM selecting appropriate tools",
+		"Executing tools dynamically",
+		"LLM orchestrating workflow",
+		"Quality validation with tools",
+	},
+}
+
+// ProcessingSteps 返回某个模式的处理步骤说明
+func ProcessingSteps(mode TaskMode) []string {
+	return processingSteps[mode]
+}
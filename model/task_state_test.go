@@ -0,0 +1,77 @@
+package model
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var allTaskStates = []TaskState{
+	TaskStatePending,
+	TaskStateProcessing,
+	TaskStateCompleted,
+	TaskStateFailed,
+	TaskStateCancelled,
+}
+
+func TestTaskStateTransitions(t *testing.T) {
+	allowed := map[TaskState][]TaskState{
+		TaskStatePending:    {TaskStateProcessing, TaskStateFailed, TaskStateCancelled},
+		TaskStateProcessing: {TaskStateCompleted, TaskStateFailed, TaskStateCancelled},
+		TaskStateFailed:     {TaskStatePending},
+	}
+
+	for _, from := range allTaskStates {
+		for _, to := range allTaskStates {
+			want := false
+			for _, next := range allowed[from] {
+				want = want || next == to
+			}
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	if TaskState("unknown").CanTransitionTo(TaskStateProcessing) {
+		t.Error("unknown state can transition")
+	}
+}
+
+func TestTaskStateIsTerminal(t *testing.T) {
+	for _, state := range allTaskStates {
+		want := state == TaskStateCompleted || state == TaskStateCancelled
+		if got := state.IsTerminal(); got != want {
+			t.Errorf("%s terminal = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestTaskStateIsFinished(t *testing.T) {
+	for _, state := range allTaskStates {
+		want := state == TaskStateCompleted || state == TaskStateCancelled || state == TaskStateFailed
+		if got := state.IsFinished(); got != want {
+			t.Errorf("%s finished = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestStatesLeadingTo(t *testing.T) {
+	tests := []struct {
+		next TaskState
+		want []TaskState
+	}{
+		{TaskStatePending, []TaskState{TaskStateFailed}},
+		{TaskStateProcessing, []TaskState{TaskStatePending}},
+		{TaskStateCompleted, []TaskState{TaskStateProcessing}},
+		{TaskStateFailed, []TaskState{TaskStatePending, TaskStateProcessing}},
+		{TaskStateCancelled, []TaskState{TaskStatePending, TaskStateProcessing}},
+	}
+	for _, tt := range tests {
+		got := statesLeadingTo(tt.next)
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("statesLeadingTo(%s) = %v, want %v", tt.next, got, tt.want)
+		}
+	}
+}
@@ -3,33 +3,115 @@ package model
 import "time"
 
 type UserInput struct {
-	Text           string                  `json:"text"`
-	Images         []string                `json:"images"`
-	Audio          string                  `json:"audio"`
-	Video          string                  `json:"video"`
-	Style          string                  `json:"style"`
-	CustomScripts  []VideoProcessingScript `json:"custom_scripts,omitempty"`  // 新增：用户自定义脚本
-	PluginSettings map[string]interface{}  `json:"plugin_settings,omitempty"` // 新增：插件配置
+	Text            string                  `json:"text"`
+	Images          []string                `json:"images"`
+	Audio           string                  `json:"audio"`
+	Video           string                  `json:"video"`
+	Style           string                  `json:"style"`
+	CustomScripts   []VideoProcessingScript `json:"custom_scripts,omitempty"`   // 新增：用户自定义脚本
+	PluginSettings  map[string]interface{}  `json:"plugin_settings,omitempty"`  // 新增：插件配置
+	CallbackURL     string                  `json:"callback_url,omitempty"`     // 任务完成或失败时回调的地址
+	AudioRole       AudioRole               `json:"audio_role,omitempty"`       // Audio 的用途，默认作为背景音乐
+	SubtitleFormats []string                `json:"subtitle_formats,omitempty"` // 输出的字幕格式：srt、vtt、ass、ttml，默认 srt
+}
+
+// AudioRole 用户提供的音频在成片中的用途
+type AudioRole string
+
+const (
+	AudioNarration AudioRole = "narration" // 作为旁白，镜头时长按音频长度分配，不再合成语音
+	AudioBGM       AudioRole = "bgm"       // 作为背景音乐，循环或截断到视频长度后垫在旁白下面
+)
+
+// AudioUsage 返回 Audio 的用途，没有音频时返回空字符串
+func (in UserInput) AudioUsage() AudioRole {
+	if in.Audio == "" {
+		return ""
+	}
+	if in.AudioRole == "" {
+		return AudioBGM
+	}
+	return in.AudioRole
 }
 
 type Shot struct {
-	Scene       string `json:"scene"`
-	ImagePrompt string `json:"image_prompt"`
-	Voiceover   string `json:"voiceover"`
-	Duration    int    `json:"duration"`
-	ClipPath    string `json:"clip_path,omitempty"`
-	VoicePath   string `json:"voice_path,omitempty"`
-	Subtitle    string `json:"subtitle,omitempty"`
+	Scene        string      `json:"scene"`
+	ImagePrompt  string      `json:"image_prompt"`
+	Voiceover    string      `json:"voiceover"`
+	Duration     int         `json:"duration"`
+	ImageRef     int         `json:"image_ref,omitempty"`    // 使用用户提供的第几张图像（从1开始），0表示生成图像
+	SourceStart  float64     `json:"source_start,omitempty"` // 剪辑模式下镜头在源视频中的起点（秒）
+	SourceEnd    float64     `json:"source_end,omitempty"`   // 剪辑模式下镜头在源视频中的终点（秒）
+	Motion       *Motion     `json:"motion,omitempty"`       // 静态图像镜头的镜头运动，未设置时按镜头序号选择
+	Transition   *Transition `json:"transition,omitempty"`   // 从前一个镜头切入本镜头的转场，未设置时使用脚本的默认转场
+	ClipPath     string      `json:"clip_path,omitempty" schema:"-"`
+	VoicePath    string      `json:"voice_path,omitempty" schema:"-"`
+	VoiceLength  float64     `json:"voice_length,omitempty" schema:"-"`  // ffprobe 测得的配音时长（秒），决定镜头时长和字幕时间
+	RenderedClip string      `json:"rendered_clip,omitempty" schema:"-"` // 渲染好的单镜头片段，重试时复用
+	Subtitle     string      `json:"subtitle,omitempty"`
+}
+
+// Motion 静态图像的推拉摇移（Ken Burns）效果
+type Motion struct {
+	Pan       string  `json:"pan,omitempty"`        // 画面移动方向：none、left、right、up、down
+	ZoomStart float64 `json:"zoom_start,omitempty"` // 起始缩放倍数，1 表示完整画面
+	ZoomEnd   float64 `json:"zoom_end,omitempty"`   // 结束缩放倍数
+	Easing    string  `json:"easing,omitempty"`     // 运动曲线：linear、ease_in、ease_out、ease_in_out
+}
+
+// 镜头运动的取值
+const (
+	PanNone  = "none"
+	PanLeft  = "left"
+	PanRight = "right"
+	PanUp    = "up"
+	PanDown  = "down"
+
+	EasingLinear = "linear"
+	EasingIn     = "ease_in"
+	EasingOut    = "ease_out"
+	EasingInOut  = "ease_in_out"
+)
+
+// MaxMotionZoom 镜头运动允许的最大缩放倍数，再大画面会明显模糊
+const MaxMotionZoom = 2.0
+
+// Transition 镜头之间的转场，转场期间前后两个镜头重叠
+type Transition struct {
+	Type     string  `json:"type"`               // cut、fade、dissolve、wipe、slide
+	Duration float64 `json:"duration,omitempty"` // 转场时长（秒），0 表示使用默认时长
+}
+
+// 转场类型
+const (
+	TransitionCut      = "cut"
+	TransitionFade     = "fade"
+	TransitionDissolve = "dissolve"
+	TransitionWipe     = "wipe"
+	TransitionSlide    = "slide"
+)
+
+// MaxTransitionDuration 转场允许的最长时长（秒）
+const MaxTransitionDuration = 2.0
+
+// HasSource 镜头是否截取自用户上传的源视频
+func (s Shot) HasSource() bool {
+	return s.SourceEnd > s.SourceStart
 }
 
 type ScriptOutput struct {
-	Title  string `json:"title"`
-	Style  string `json:"style"`
-	Shots  []Shot `json:"shots"`
-	BGM    string `json:"bgm"`
-	Final  string `json:"final,omitempty"`
-	TaskID string `json:"task_id,omitempty"`
-	Status string `json:"status,omitempty"`
+	Title           string            `json:"title"`
+	Style           string            `json:"style"`
+	Shots           []Shot            `json:"shots"`
+	BGM             string            `json:"bgm"`
+	Transition      *Transition       `json:"transition,omitempty"`                  // 镜头没有指定转场时使用的默认转场
+	Narration       string            `json:"narration,omitempty" schema:"-"`        // 用户提供的旁白音轨，设置后镜头不再单独配音
+	BGMPath         string            `json:"bgm_path,omitempty" schema:"-"`         // 用户提供的背景音乐，渲染时混在旁白下面
+	SubtitleFormats []string          `json:"subtitle_formats,omitempty" schema:"-"` // 需要输出的字幕格式
+	Subtitles       map[string]string `json:"subtitles,omitempty" schema:"-"`        // 渲染时生成的字幕文件，按格式索引
+	Final           string            `json:"final,omitempty" schema:"-"`
+	TaskID          string            `json:"task_id,omitempty" schema:"-"`
+	Status          string            `json:"status,omitempty" schema:"-"`
 }
 
 // Database model
@@ -38,7 +120,13 @@ type VideoTask struct {
 	TaskID    string    `json:"task_id"`
 	Input     string    `json:"input"`
 	Output    string    `json:"output"`
+	Status    TaskState `json:"status"`
+	Stage     string    `json:"stage"`
+	Progress  int       `json:"progress"`
+	Error     string    `json:"error,omitempty"`
+	Mode      TaskMode  `json:"mode"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // API Response structures
@@ -90,13 +178,15 @@ type PluginRegistry struct {
 
 // 新增：扩展的任务状态
 type ExtendedTaskStatus struct {
-	TaskID          string    `json:"task_id"`
-	Status          string    `json:"status"`
-	Progress        int       `json:"progress"`
-	CurrentStage    string    `json:"current_stage"`
-	ProcessingSteps []string  `json:"processing_steps"`
-	ExecutedScripts []string  `json:"executed_scripts,omitempty"`
-	Errors          []string  `json:"errors,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	TaskID          string      `json:"task_id"`
+	Status          string      `json:"status"`
+	Mode            string      `json:"mode,omitempty"`
+	Progress        int         `json:"progress"`
+	CurrentStage    string      `json:"current_stage"`
+	ProcessingSteps []string    `json:"processing_steps"`
+	ExecutedScripts []string    `json:"executed_scripts,omitempty"`
+	Errors          []string    `json:"errors,omitempty"`
+	Result          interface{} `json:"result,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
 }
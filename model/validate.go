@@ -0,0 +1,107 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError 描述脚本中某个字段的问题
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors 一组字段错误
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, e := range v {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate 检查LLM生成的脚本是否可以直接进入生产流程
+func (s *ScriptOutput) Validate() ValidationErrors {
+	var errs ValidationErrors
+
+	if strings.TrimSpace(s.Title) == "" {
+		errs = append(errs, FieldError{Field: "title", Message: "must not be empty"})
+	}
+	if len(s.Shots) == 0 {
+		errs = append(errs, FieldError{Field: "shots", Message: "must contain at least one shot"})
+	}
+
+	if s.Transition != nil {
+		errs = append(errs, s.Transition.validate("transition")...)
+	}
+
+	for i, shot := range s.Shots {
+		prefix := fmt.Sprintf("shots[%d]", i)
+		// 截取自源视频的镜头不需要生成图像
+		if strings.TrimSpace(shot.ImagePrompt) == "" && !shot.HasSource() {
+			errs = append(errs, FieldError{Field: prefix + ".image_prompt", Message: "must not be empty"})
+		}
+		if strings.TrimSpace(shot.Voiceover) == "" {
+			errs = append(errs, FieldError{Field: prefix + ".voiceover", Message: "must not be empty"})
+		}
+		if shot.Duration <= 0 {
+			errs = append(errs, FieldError{Field: prefix + ".duration", Message: fmt.Sprintf("must be a positive number of seconds, got %d", shot.Duration)})
+		}
+		if shot.Motion != nil {
+			errs = append(errs, shot.Motion.validate(prefix+".motion")...)
+		}
+		if shot.Transition != nil {
+			errs = append(errs, shot.Transition.validate(prefix+".transition")...)
+		}
+	}
+
+	return errs
+}
+
+func (m *Motion) validate(prefix string) ValidationErrors {
+	var errs ValidationErrors
+
+	switch m.Pan {
+	case "", PanNone, PanLeft, PanRight, PanUp, PanDown:
+	default:
+		errs = append(errs, FieldError{Field: prefix + ".pan", Message: fmt.Sprintf("must be one of none, left, right, up, down, got %q", m.Pan)})
+	}
+	switch m.Easing {
+	case "", EasingLinear, EasingIn, EasingOut, EasingInOut:
+	default:
+		errs = append(errs, FieldError{Field: prefix + ".easing", Message: fmt.Sprintf("must be one of linear, ease_in, ease_out, ease_in_out, got %q", m.Easing)})
+	}
+	zooms := []struct {
+		field string
+		value float64
+	}{{"zoom_start", m.ZoomStart}, {"zoom_end", m.ZoomEnd}}
+	for _, zoom := range zooms {
+		// 0 表示未设置，按 1 处理
+		if zoom.value != 0 && (zoom.value < 1 || zoom.value > MaxMotionZoom) {
+			errs = append(errs, FieldError{Field: prefix + "." + zoom.field, Message: fmt.Sprintf("must be between 1 and %g, got %g", MaxMotionZoom, zoom.value)})
+		}
+	}
+
+	return errs
+}
+
+func (t *Transition) validate(prefix string) ValidationErrors {
+	var errs ValidationErrors
+
+	switch t.Type {
+	case TransitionCut, TransitionFade, TransitionDissolve, TransitionWipe, TransitionSlide:
+	default:
+		errs = append(errs, FieldError{Field: prefix + ".type", Message: fmt.Sprintf("must be one of cut, fade, dissolve, wipe, slide, got %q", t.Type)})
+	}
+	if t.Duration < 0 || t.Duration > MaxTransitionDuration {
+		errs = append(errs, FieldError{Field: prefix + ".duration", Message: fmt.Sprintf("must be between 0 and %g seconds, got %g", MaxTransitionDuration, t.Duration)})
+	}
+
+	return errs
+}
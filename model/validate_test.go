@@ -0,0 +1,89 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func validScript() ScriptOutput {
+	return ScriptOutput{
+		Title: "City",
+		Shots: []Shot{
+			{ImagePrompt: "A skyline at dawn", Voiceover: "Morning.", Duration: 3},
+			{ImagePrompt: "A skyline at night", Voiceover: "Evening.", Duration: 3},
+		},
+	}
+}
+
+func TestScriptValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*ScriptOutput)
+		fields []string
+	}{
+		{"valid", func(s *ScriptOutput) {}, nil},
+		{"blank title", func(s *ScriptOutput) { s.Title = "  " }, []string{"title"}},
+		{"no shots", func(s *ScriptOutput) { s.Shots = nil }, []string{"shots"}},
+		{"missing image prompt", func(s *ScriptOutput) { s.Shots[1].ImagePrompt = "" }, []string{"shots[1].image_prompt"}},
+		{"source shot needs no image prompt", func(s *ScriptOutput) {
+			s.Shots[0].ImagePrompt = ""
+			s.Shots[0].SourceStart, s.Shots[0].SourceEnd = 2, 5
+		}, nil},
+		{"empty source range needs image prompt", func(s *ScriptOutput) {
+			s.Shots[0].ImagePrompt = ""
+			s.Shots[0].SourceStart, s.Shots[0].SourceEnd = 5, 5
+		}, []string{"shots[0].image_prompt"}},
+		{"missing voiceover", func(s *ScriptOutput) { s.Shots[0].Voiceover = "" }, []string{"shots[0].voiceover"}},
+		{"zero duration", func(s *ScriptOutput) { s.Shots[0].Duration = 0 }, []string{"shots[0].duration"}},
+		{"negative duration", func(s *ScriptOutput) { s.Shots[1].Duration = -2 }, []string{"shots[1].duration"}},
+		{"valid motion", func(s *ScriptOutput) {
+			s.Shots[0].Motion = &Motion{Pan: PanLeft, ZoomStart: 1, ZoomEnd: MaxMotionZoom, Easing: EasingInOut}
+		}, nil},
+		{"unset zoom", func(s *ScriptOutput) { s.Shots[0].Motion = &Motion{Pan: PanUp} }, nil},
+		{"bad motion", func(s *ScriptOutput) {
+			s.Shots[0].Motion = &Motion{Pan: "diagonal", ZoomStart: 0.5, ZoomEnd: 3, Easing: "bounce"}
+		}, []string{"shots[0].motion.pan", "shots[0].motion.easing", "shots[0].motion.zoom_start", "shots[0].motion.zoom_end"}},
+		{"valid transitions", func(s *ScriptOutput) {
+			s.Transition = &Transition{Type: TransitionFade}
+			s.Shots[1].Transition = &Transition{Type: TransitionWipe, Duration: MaxTransitionDuration}
+		}, nil},
+		{"bad default transition", func(s *ScriptOutput) { s.Transition = &Transition{Type: "spin"} }, []string{"transition.type"}},
+		{"bad shot transition", func(s *ScriptOutput) {
+			s.Shots[1].Transition = &Transition{Type: TransitionFade, Duration: 2.5}
+		}, []string{"shots[1].transition.duration"}},
+		{"negative transition", func(s *ScriptOutput) {
+			s.Shots[1].Transition = &Transition{Type: TransitionDissolve, Duration: -1}
+		}, []string{"shots[1].transition.duration"}},
+		{"several problems", func(s *ScriptOutput) {
+			s.Title = ""
+			s.Shots[0].Voiceover = ""
+			s.Shots[1].Duration = 0
+		}, []string{"title", "shots[0].voiceover", "shots[1].duration"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := validScript()
+			tt.mutate(&script)
+
+			var fields []string
+			for _, err := range script.Validate() {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("got errors on %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestValidationErrorsError(t *testing.T) {
+	errs := ValidationErrors{
+		{Field: "title", Message: "must not be empty"},
+		{Field: "shots[0].duration", Message: "must be a positive number of seconds, got 0"},
+	}
+	want := "title: must not be empty; shots[0].duration: must be a positive number of seconds, got 0"
+	if got := errs.Error(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
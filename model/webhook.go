@@ -0,0 +1,236 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// WebhookEvent 回调通知的事件类型
+type WebhookEvent string
+
+const (
+	WebhookTaskCompleted WebhookEvent = "task.completed"
+	WebhookTaskFailed    WebhookEvent = "task.failed"
+)
+
+// WebhookDeliveryStatus 回调投递的状态
+type WebhookDeliveryStatus string
+
+const (
+	WebhookPending   WebhookDeliveryStatus = "pending"   // 等待投递或等待重试
+	WebhookDelivered WebhookDeliveryStatus = "delivered" // 接收方返回了2xx
+	WebhookFailed    WebhookDeliveryStatus = "failed"    // 重试次数用尽
+)
+
+// WebhookPayload 回调请求体
+type WebhookPayload struct {
+	Event     WebhookEvent  `json:"event"`
+	TaskID    string        `json:"task_id"`
+	Status    TaskState     `json:"status"`
+	Mode      TaskMode      `json:"mode"`
+	Result    *ScriptOutput `json:"result,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// WebhookDelivery 一次回调通知，失败后按退避策略重试
+type WebhookDelivery struct {
+	ID            int64                 `json:"id"`
+	TaskID        string                `json:"task_id"`
+	Event         WebhookEvent          `json:"event"`
+	URL           string                `json:"url"`
+	Payload       string                `json:"payload"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	MaxAttempts   int                   `json:"max_attempts"`
+	NextAttemptAt *time.Time            `json:"next_attempt_at,omitempty"`
+	LastError     string                `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+	History       []WebhookAttempt      `json:"history,omitempty"`
+}
+
+// WebhookAttempt 一次投递尝试的结果
+type WebhookAttempt struct {
+	DeliveryID int64     `json:"delivery_id"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const webhookColumns = `id, task_id, event, url, payload, status, attempts, max_attempts,
+	next_attempt_at, COALESCE(last_error, ''), delivered_at, created_at, updated_at`
+
+// CreateWebhookDelivery 记录一次待投递的回调，由worker的投递循环发送
+func CreateWebhookDelivery(taskID string, event WebhookEvent, url string, payload []byte, maxAttempts int) (int64, error) {
+	query := `INSERT INTO webhook_deliveries (task_id, event, url, payload, status, attempts, max_attempts,
+		next_attempt_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, 0, ?, NOW(), NOW(), NOW())`
+	result, err := DB.Exec(query, taskID, event, url, string(payload), WebhookPending, maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ClaimDueWebhooks 领取已到重试时间的投递，并把下次尝试时间推后lease，
+// 避免多个worker同时投递同一条回调
+func ClaimDueWebhooks(limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + webhookColumns + ` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= NOW() ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(query, WebhookPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	update := `UPDATE webhook_deliveries SET next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND), updated_at = NOW()
+		WHERE id = ?`
+	for _, delivery := range deliveries {
+		if _, err := tx.Exec(update, leaseSeconds(lease), delivery.ID); err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, tx.Commit()
+}
+
+// RecordWebhookAttempt 记录一次投递尝试。成功时标记为已投递；失败且还有剩余次数时
+// 在retryIn之后重试，否则标记为失败
+func RecordWebhookAttempt(delivery *WebhookDelivery, attempt WebhookAttempt, retryIn time.Duration) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert := `INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, NOW())`
+	_, err = tx.Exec(insert, delivery.ID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMs)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case attempt.Error == "":
+		query := `UPDATE webhook_deliveries SET status = ?, attempts = ?, last_error = '', next_attempt_at = NULL,
+			delivered_at = NOW(), updated_at = NOW() WHERE id = ?`
+		_, err = tx.Exec(query, WebhookDelivered, attempt.Attempt, delivery.ID)
+	case attempt.Attempt >= delivery.MaxAttempts:
+		query := `UPDATE webhook_deliveries SET status = ?, attempts = ?, last_error = ?, next_attempt_at = NULL,
+			updated_at = NOW() WHERE id = ?`
+		_, err = tx.Exec(query, WebhookFailed, attempt.Attempt, attempt.Error, delivery.ID)
+	default:
+		query := `UPDATE webhook_deliveries SET attempts = ?, last_error = ?,
+			next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND), updated_at = NOW() WHERE id = ?`
+		_, err = tx.Exec(query, attempt.Attempt, attempt.Error, leaseSeconds(retryIn), delivery.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListWebhookDeliveries 列出任务的全部回调及每次投递尝试
+func ListWebhookDeliveries(taskID string) ([]WebhookDelivery, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook_deliveries WHERE task_id = ? ORDER BY id`
+	rows, err := DB.Query(query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range deliveries {
+		history, err := listWebhookAttempts(deliveries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		deliveries[i].History = history
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDelivery 读取单条回调
+func GetWebhookDelivery(id int64) (*WebhookDelivery, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook_deliveries WHERE id = ?`
+	rows, err := DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &deliveries[0], nil
+}
+
+// RedeliverWebhook 立即重新投递一条回调，并在已用次数之上再给予extraAttempts次重试机会
+func RedeliverWebhook(id int64, extraAttempts int) error {
+	if _, err := GetWebhookDelivery(id); err != nil {
+		return err
+	}
+
+	query := `UPDATE webhook_deliveries SET status = ?, max_attempts = attempts + ?, next_attempt_at = NOW(),
+		updated_at = NOW() WHERE id = ?`
+	_, err := DB.Exec(query, WebhookPending, extraAttempts, id)
+	return err
+}
+
+func listWebhookAttempts(deliveryID int64) ([]WebhookAttempt, error) {
+	query := `SELECT delivery_id, attempt, status_code, COALESCE(error, ''), duration_ms, created_at
+		FROM webhook_attempts WHERE delivery_id = ? ORDER BY id`
+	rows, err := DB.Query(query, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []WebhookAttempt
+	for rows.Next() {
+		var a WebhookAttempt
+		if err := rows.Scan(&a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.DurationMs, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var nextAttemptAt, deliveredAt sql.NullTime
+		err := rows.Scan(&d.ID, &d.TaskID, &d.Event, &d.URL, &d.Payload, &d.Status, &d.Attempts, &d.MaxAttempts,
+			&nextAttemptAt, &d.LastError, &deliveredAt, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if nextAttemptAt.Valid {
+			d.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,78 @@
+// Package netguard keeps server-side requests to caller-supplied URLs, such
+// as webhooks and media downloads, away from loopback, private, link-local
+// and cloud metadata addresses.
+package netguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// resolveTimeout 校验地址时解析主机名的超时
+const resolveTimeout = 5 * time.Second
+
+// sharedAddressSpace 运营商级 NAT 使用的地址段（RFC 6598），同样不能从外部访问
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// ValidateURL 检查地址是否为绝对的 http(s) 地址，且主机解析出的地址都是公网地址。
+// 返回的错误以谓语开头，调用方在前面加上字段名，例如 "callback_url must be ..."
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("must be an absolute http or https URL")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("host %s cannot be resolved: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return fmt.Errorf("host %s resolves to non-public address %s", u.Hostname(), addr.Unmap())
+		}
+	}
+	return nil
+}
+
+// IsPublic 判断地址是否为可以从外部访问的公网单播地址
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// dialPublicOnly 在建立连接前再检查一次实际连接的地址，防止主机名在校验后被解析到内网（DNS rebinding）
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(addr) {
+		return fmt.Errorf("refusing to connect to non-public address %s", addr.Unmap())
+	}
+	return nil
+}
+
+// NewTransport 只连接公网地址、不使用代理的传输层。
+// 每次连接都会检查目标地址，所以经重定向访问内网也会被拒绝
+func NewTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, Control: dialPublicOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
@@ -0,0 +1,69 @@
+package netguard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://8.8.8.8/video.mp4", true},
+		{"https://[2606:4700:4700::1111]/a.png", true},
+		{"file:///etc/passwd", false},
+		{"/etc/passwd", false},
+		{"https:///a.png", false},
+		{"http://127.0.0.1/a.png", false},
+		{"http://localhost:9000/a.png", false},
+		{"http://10.1.2.3/a.png", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://[::ffff:127.0.0.1]/a.png", false},
+	}
+	for _, tt := range tests {
+		err := ValidateURL(tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateURL(%q) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":      true,
+		"2606:4700::1111":    true,
+		"127.0.0.1":          false,
+		"10.0.0.1":           false,
+		"100.127.255.254":    false,
+		"169.254.169.254":    false,
+		"::ffff:192.168.0.1": false,
+		"fc00::1":            false,
+		"::":                 false,
+	} {
+		if got := IsPublic(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("IsPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestTransportRefusesPrivateAddresses(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport()}
+	_, err := client.Get(srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "non-public") {
+		t.Errorf("got %v, want the loopback address refused", err)
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Error("request reached a loopback address")
+	}
+}
@@ -46,6 +46,33 @@ func (ls *LocalStorage) Save(src, dest string) (string, error) {
 	return destPath, nil
 }
 
+// Write stores the content of r at dest and returns the full path. A partially
+// written file is removed on error.
+func (ls *LocalStorage) Write(dest string, r io.Reader) (string, error) {
+	destPath := filepath.Join(ls.BasePath, dest)
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return "", err
+	}
+
+	destFile, err := os.Create(destPath)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(destFile, r); err != nil {
+		destFile.Close()
+		os.Remove(destPath)
+		return "", err
+	}
+	if err := destFile.Close(); err != nil {
+		os.Remove(destPath)
+		return "", err
+	}
+
+	return destPath, nil
+}
+
 func (ls *LocalStorage) Get(path string) (string, error) {
 	fullPath := filepath.Join(ls.BasePath, path)
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
@@ -0,0 +1,67 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ASS 的坐标和字号相对于 PlayResX x PlayResY 的画布，与 libass 的默认值一致，
+// 这样烧录时 force_style 和 ASS 文件中的字号效果相同
+const (
+	assPlayResX = 384
+	assPlayResY = 288
+)
+
+// assAlignment 位置对应的 ASS 小键盘对齐方式
+var assAlignment = map[string]int{
+	PositionBottom: 2,
+	PositionMiddle: 5,
+	PositionTop:    8,
+}
+
+// assEscaper 花括号会被解析为覆盖标签，反斜杠开启转义
+var assEscaper = strings.NewReplacer(`\`, `\\`, "{", `\{`, "}", `\}`)
+
+// writeASS 写出 Advanced SubStation Alpha 字幕，包含 Script Info、V4+ Styles 和 Events 三节。
+// ASS 的时间精度为百分之一秒
+func writeASS(w io.Writer, track Track) error {
+	style := track.Style
+	alignment, ok := assAlignment[style.Position]
+	if !ok {
+		alignment = assAlignment[PositionBottom]
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "[Script Info]\nScriptType: v4.00+\nPlayResX: %d\nPlayResY: %d\nWrapStyle: 0\nScaledBorderAndShadow: yes\n\n",
+		assPlayResX, assPlayResY)
+
+	bw.WriteString("[V4+ Styles]\n")
+	bw.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, " +
+		"Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, " +
+		"Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	// 白字黑边，半透明阴影
+	fmt.Fprintf(bw, "Style: Default,%s,%d,&H00FFFFFF,&H000000FF,&H00000000,&H64000000,0,0,0,0,100,100,0,0,1,%d,0,%d,10,10,%d,1\n\n",
+		style.Font, style.FontSize, style.Outline, alignment, style.Margin)
+
+	bw.WriteString("[Events]\n")
+	bw.WriteString("Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	for _, cue := range track.Cues {
+		text := lines(cue.Text)
+		for i := range text {
+			text[i] = assEscaper.Replace(text[i])
+		}
+		fmt.Fprintf(bw, "Dialogue: 0,%s,%s,Default,,0,0,0,,%s\n", assTime(cue.Start), assTime(cue.End), strings.Join(text, `\N`))
+	}
+	return bw.Flush()
+}
+
+func assTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	centis := int(d.Round(10*time.Millisecond) / (10 * time.Millisecond))
+	return fmt.Sprintf("%d:%02d:%02d.%02d", centis/360000, centis/6000%60, centis/100%60, centis%100)
+}
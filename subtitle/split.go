@@ -0,0 +1,147 @@
+package subtitle
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sentenceEnds 句末标点，之后断开为新的字幕
+const sentenceEnds = "。！？!?…"
+
+// clauseEnds 分句标点，句子过长时在这里断开
+const clauseEnds = "，,；;：:、"
+
+// Split 把一段旁白拆分为多条字幕：先按句子断开，超过 maxChars 个字符的句子再按分句标点断开，
+// 仍然过长时按空格或直接按长度断开。maxChars 不大于0时只按句子断开
+func Split(text string, maxChars int) []string {
+	var parts []string
+	for _, sentence := range splitAfter(text, isSentenceEnd) {
+		if maxChars <= 0 || utf8.RuneCountInString(sentence) <= maxChars {
+			parts = append(parts, sentence)
+			continue
+		}
+		clauses := splitAfter(sentence, func(r []rune, i int) bool {
+			return strings.ContainsRune(clauseEnds, r[i])
+		})
+		for _, clause := range mergeShort(clauses, maxChars) {
+			parts = append(parts, splitLong(clause, maxChars)...)
+		}
+	}
+	return parts
+}
+
+// Distribute 把 [start, end) 按各段的字符数分给每条字幕，朗读时长大致与字数成正比
+func Distribute(start, end time.Duration, parts []string) []Cue {
+	total := 0
+	for _, part := range parts {
+		total += utf8.RuneCountInString(part)
+	}
+	if total == 0 || end <= start {
+		return nil
+	}
+
+	cues := make([]Cue, 0, len(parts))
+	chars := 0
+	cueStart := start
+	for i, part := range parts {
+		chars += utf8.RuneCountInString(part)
+		cueEnd := start + (end-start)*time.Duration(chars)/time.Duration(total)
+		if i == len(parts)-1 {
+			cueEnd = end
+		}
+		cues = append(cues, Cue{Start: cueStart, End: cueEnd, Text: part})
+		cueStart = cueEnd
+	}
+	return cues
+}
+
+// isSentenceEnd 英文句点只有后面是空白或结尾时才算句末，避免拆开 3.5 这样的数字
+func isSentenceEnd(r []rune, i int) bool {
+	if strings.ContainsRune(sentenceEnds, r[i]) {
+		return true
+	}
+	return r[i] == '.' && (i == len(r)-1 || unicode.IsSpace(r[i+1]))
+}
+
+// splitAfter 在满足 isEnd 的字符之后断开，标点保留在前一段，连续的标点不会产生空段
+func splitAfter(text string, isEnd func(r []rune, i int) bool) []string {
+	r := []rune(strings.TrimSpace(text))
+	var parts []string
+	start := 0
+	for i := range r {
+		if !isEnd(r, i) {
+			continue
+		}
+		// 连续的标点（如 "?!"、"……"）归入同一段
+		if i+1 < len(r) && isEnd(r, i+1) {
+			continue
+		}
+		if part := strings.TrimSpace(string(r[start : i+1])); part != "" {
+			parts = append(parts, part)
+		}
+		start = i + 1
+	}
+	if part := strings.TrimSpace(string(r[start:])); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// mergeShort 合并相邻的短分句，合并后不超过 maxChars
+func mergeShort(clauses []string, maxChars int) []string {
+	var merged []string
+	for _, clause := range clauses {
+		last := len(merged) - 1
+		if last >= 0 && utf8.RuneCountInString(merged[last])+utf8.RuneCountInString(joiner(merged[last]))+utf8.RuneCountInString(clause) <= maxChars {
+			merged[last] += joiner(merged[last]) + clause
+			continue
+		}
+		merged = append(merged, clause)
+	}
+	return merged
+}
+
+// splitLong 把仍然过长的文本按空格断开，没有空格（如中文）时按长度断开
+func splitLong(text string, maxChars int) []string {
+	if utf8.RuneCountInString(text) <= maxChars {
+		return []string{text}
+	}
+
+	var parts []string
+	var current []rune
+	for _, word := range strings.Fields(text) {
+		w := []rune(word)
+		for len(w) > maxChars {
+			if len(current) > 0 {
+				parts = append(parts, string(current))
+				current = nil
+			}
+			parts = append(parts, string(w[:maxChars]))
+			w = w[maxChars:]
+		}
+		switch {
+		case len(current) == 0:
+			current = w
+		case len(current)+1+len(w) <= maxChars:
+			current = append(append(current, ' '), w...)
+		default:
+			parts = append(parts, string(current))
+			current = w
+		}
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}
+
+// joiner 合并分句时，英文标点后补一个空格，中文标点后直接相连
+func joiner(prev string) string {
+	last, _ := utf8.DecodeLastRuneInString(prev)
+	if last < utf8.RuneSelf {
+		return " "
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package subtitle
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxChars int
+		want     []string
+	}{
+		{"empty", "  ", 10, nil},
+		{"sentences only", "First sentence. Second one! Third?", 0, []string{"First sentence.", "Second one!", "Third?"}},
+		{"negative limit keeps long sentences", "This sentence is far longer than the limit.", -1, []string{"This sentence is far longer than the limit."}},
+		{"decimal point", "Pi is about 3.14 today. Really.", 0, []string{"Pi is about 3.14 today.", "Really."}},
+		{"repeated punctuation", "真的吗？！太好了……", 0, []string{"真的吗？！", "太好了……"}},
+		{"cjk sentences", "今天天气很好，我们去公园吧。你觉得怎么样？", 8, []string{"今天天气很好，", "我们去公园吧。", "你觉得怎么样？"}},
+		{"cjk clauses merge without space", "好，走吧，我们出发。", 6, []string{"好，走吧，", "我们出发。"}},
+		{"english clauses merge with space", "Well, yes, but no, never again.", 12, []string{"Well, yes,", "but no,", "never again."}},
+		{"split at spaces", "one two three four five", 9, []string{"one two", "three", "four five"}},
+		{"cjk without punctuation", "一二三四五六七八九十", 4, []string{"一二三四", "五六七八", "九十"}},
+		{"single long word", "Supercalifragilistic is long.", 8, []string{"Supercal", "ifragili", "stic is", "long."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Split(tt.text, tt.maxChars); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split(%q, %d) = %q, want %q", tt.text, tt.maxChars, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name       string
+		start, end time.Duration
+		parts      []string
+		want       []Cue
+	}{
+		{"by character count", time.Second, 4 * time.Second, []string{"ab", "cdef"}, []Cue{
+			{Start: time.Second, End: 2 * time.Second, Text: "ab"},
+			{Start: 2 * time.Second, End: 4 * time.Second, Text: "cdef"},
+		}},
+		{"counts runes", 0, 3 * time.Second, []string{"你好", "世界和平"}, []Cue{
+			{Start: 0, End: time.Second, Text: "你好"},
+			{Start: time.Second, End: 3 * time.Second, Text: "世界和平"},
+		}},
+		{"last cue ends exactly", time.Second, 2 * time.Second, []string{"a", "b", "c"}, []Cue{
+			{Start: time.Second, End: 1333333333, Text: "a"},
+			{Start: 1333333333, End: 1666666666, Text: "b"},
+			{Start: 1666666666, End: 2 * time.Second, Text: "c"},
+		}},
+		{"single part", 500 * ms, 1500 * ms, []string{"Hello."}, []Cue{
+			{Start: 500 * ms, End: 1500 * ms, Text: "Hello."},
+		}},
+		{"no parts", 0, time.Second, nil, nil},
+		{"empty parts", 0, time.Second, []string{""}, nil},
+		{"empty range", time.Second, time.Second, []string{"a"}, nil},
+		{"reversed range", 2 * time.Second, time.Second, []string{"a"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Distribute(tt.start, tt.end, tt.parts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// writeSRT 写出 SubRip 字幕，时间格式为 00:00:01,500
+func writeSRT(w io.Writer, track Track) error {
+	bw := bufio.NewWriter(w)
+	for i, cue := range track.Cues {
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n\n",
+			i+1, srtTime(cue.Start), srtTime(cue.End), strings.Join(lines(cue.Text), "\n"))
+	}
+	return bw.Flush()
+}
+
+func srtTime(d time.Duration) string {
+	h, m, s, ms := clock(d)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", h, m, s, ms)
+}
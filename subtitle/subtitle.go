@@ -0,0 +1,124 @@
+// Package subtitle models timed captions and writes them as SRT, WebVTT,
+// ASS or TTML. Cue times are kept as time.Duration and written with
+// millisecond precision, except ASS which only supports centiseconds.
+package subtitle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format 字幕文件格式
+type Format string
+
+const (
+	SRT  Format = "srt"
+	VTT  Format = "vtt"
+	ASS  Format = "ass"
+	TTML Format = "ttml"
+)
+
+// Formats 支持的全部格式
+var Formats = []Format{SRT, VTT, ASS, TTML}
+
+// aliases 请求中可以使用的其他名称
+var aliases = map[string]Format{
+	"webvtt": VTT,
+	"ssa":    ASS,
+	"dfxp":   TTML,
+}
+
+// ParseFormat 解析格式名称，不区分大小写
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	if f, ok := aliases[name]; ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported subtitle format %q, expected one of srt, vtt, ass, ttml", name)
+}
+
+// Extension 格式对应的文件扩展名
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Cue 一条字幕，Text 可以包含换行
+type Cue struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	Text  string        `json:"text"`
+}
+
+// 字幕在画面中的位置
+const (
+	PositionBottom = "bottom"
+	PositionMiddle = "middle"
+	PositionTop    = "top"
+)
+
+// Style 字幕样式。ASS 和 TTML 会写入完整样式，WebVTT 只使用位置，SRT 不带样式
+type Style struct {
+	Font     string
+	FontSize int
+	Outline  int
+	Position string // bottom、middle 或 top
+	Margin   int    // 与所在边缘的距离
+}
+
+// DefaultStyle 未指定样式时使用
+var DefaultStyle = Style{Font: "Arial", FontSize: 24, Outline: 2, Position: PositionBottom, Margin: 30}
+
+// Track 一组字幕及其语言和样式
+type Track struct {
+	Cues     []Cue
+	Language string // BCP 47 语言标签，为空时不写入
+	Style    Style
+}
+
+// Write 按指定格式写出字幕
+func Write(w io.Writer, format Format, track Track) error {
+	switch format {
+	case SRT:
+		return writeSRT(w, track)
+	case VTT:
+		return writeVTT(w, track)
+	case ASS:
+		return writeASS(w, track)
+	case TTML:
+		return writeTTML(w, track)
+	default:
+		return fmt.Errorf("unsupported subtitle format %q", format)
+	}
+}
+
+// Encode 按指定格式生成字幕内容
+func Encode(format Format, track Track) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, format, track); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// clock 把时间拆分为时、分、秒、毫秒，负数按0处理
+func clock(d time.Duration) (hours, minutes, seconds, millis int) {
+	if d < 0 {
+		d = 0
+	}
+	total := int(d.Round(time.Millisecond) / time.Millisecond)
+	return total / 3600000, total / 60000 % 60, total / 1000 % 60, total % 1000
+}
+
+// lines 统一换行符并去掉首尾空白
+func lines(text string) []string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\r\n", "\n")
+	return strings.Split(text, "\n")
+}
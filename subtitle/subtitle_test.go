@@ -0,0 +1,214 @@
+package subtitle
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCues covers negative starts, millisecond and centisecond rounding,
+// hours, CRLF line breaks and characters each format has to escape.
+var testCues = []Cue{
+	{Start: -200 * time.Millisecond, End: 1500 * time.Millisecond, Text: "  Hello, world.  "},
+	{Start: 2995 * time.Millisecond, End: time.Hour + 2*time.Minute + 3456500*time.Microsecond, Text: "Tom & \"Jerry\" <b>\r\n{hi} \\o/"},
+}
+
+func TestWriteSRT(t *testing.T) {
+	want := `1
+00:00:00,000 --> 00:00:01,500
+Hello, world.
+
+2
+00:00:02,995 --> 01:02:03,457
+Tom & "Jerry" <b>
+{hi} \o/
+
+`
+	checkEncode(t, SRT, Track{Cues: testCues, Style: DefaultStyle}, want)
+}
+
+func TestWriteVTT(t *testing.T) {
+	want := `WEBVTT
+
+1
+00:00:00.000 --> 00:00:01.500 line:0 align:center
+Hello, world.
+
+2
+00:00:02.995 --> 01:02:03.457 line:0 align:center
+Tom &amp; "Jerry" &lt;b&gt;
+{hi} \o/
+
+`
+	style := DefaultStyle
+	style.Position = PositionTop
+	checkEncode(t, VTT, Track{Cues: testCues, Style: style}, want)
+}
+
+func TestVTTSettings(t *testing.T) {
+	for position, want := range map[string]string{
+		PositionBottom: "",
+		PositionMiddle: " line:50% align:center",
+		PositionTop:    " line:0 align:center",
+		"":             "",
+	} {
+		if got := vttSettings(Style{Position: position}); got != want {
+			t.Errorf("vttSettings(%q) = %q, want %q", position, got, want)
+		}
+	}
+}
+
+func TestWriteASS(t *testing.T) {
+	want := `[Script Info]
+ScriptType: v4.00+
+PlayResX: 384
+PlayResY: 288
+WrapStyle: 0
+ScaledBorderAndShadow: yes
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Arial,24,&H00FFFFFF,&H000000FF,&H00000000,&H64000000,0,0,0,0,100,100,0,0,1,2,0,5,10,10,30,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:00.00,0:00:01.50,Default,,0,0,0,,Hello, world.
+Dialogue: 0,0:00:03.00,1:02:03.46,Default,,0,0,0,,Tom & "Jerry" <b>\N\{hi\} \\o/
+`
+	style := DefaultStyle
+	style.Position = PositionMiddle
+	checkEncode(t, ASS, Track{Cues: testCues, Style: style}, want)
+}
+
+func TestASSAlignment(t *testing.T) {
+	for position, want := range map[string]string{
+		PositionBottom: ",1,2,0,2,10,10,30,1",
+		PositionMiddle: ",1,2,0,5,10,10,30,1",
+		PositionTop:    ",1,2,0,8,10,10,30,1",
+		"left":         ",1,2,0,2,10,10,30,1",
+	} {
+		style := DefaultStyle
+		style.Position = position
+		data, err := Encode(ASS, Track{Style: style})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want+"\n") {
+			t.Errorf("position %q: style line does not end with %q:\n%s", position, want, data)
+		}
+	}
+}
+
+func TestASSTime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{-time.Second, "0:00:00.00"},
+		{0, "0:00:00.00"},
+		{4 * time.Millisecond, "0:00:00.00"},
+		{5 * time.Millisecond, "0:00:00.01"},
+		{1234 * time.Millisecond, "0:00:01.23"},
+		{59995 * time.Millisecond, "0:01:00.00"},
+		{10*time.Hour + 1500*time.Millisecond, "10:00:01.50"},
+	}
+	for _, tt := range tests {
+		if got := assTime(tt.d); got != tt.want {
+			t.Errorf("assTime(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTTML(t *testing.T) {
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" xml:lang="en-US">
+  <head>
+    <styling>
+      <style xml:id="default" tts:fontFamily="Noto Sans &amp; Co" tts:fontSize="32px" tts:color="white" tts:textAlign="center"/>
+    </styling>
+    <layout>
+      <region xml:id="subtitle" tts:origin="10% 5%" tts:extent="80% 20%" tts:displayAlign="before"/>
+    </layout>
+  </head>
+  <body style="default" region="subtitle">
+    <div>
+      <p begin="00:00:00.000" end="00:00:01.500">Hello, world.</p>
+      <p begin="00:00:02.995" end="01:02:03.457">Tom &amp; &#34;Jerry&#34; &lt;b&gt;<br/>{hi} \o/</p>
+    </div>
+  </body>
+</tt>
+`
+	track := Track{
+		Cues:     testCues,
+		Language: "en-US",
+		Style:    Style{Font: "Noto Sans & Co", FontSize: 32, Position: PositionTop, Margin: 30},
+	}
+	got := checkEncode(t, TTML, track, want)
+
+	var doc struct {
+		XMLName xml.Name
+		Body    struct {
+			P []string `xml:"div>p"`
+		} `xml:"body"`
+	}
+	if err := xml.Unmarshal(got, &doc); err != nil {
+		t.Fatalf("output is not well-formed XML: %v", err)
+	}
+	if len(doc.Body.P) != 2 || doc.Body.P[0] != "Hello, world." {
+		t.Errorf("parsed paragraphs %q", doc.Body.P)
+	}
+}
+
+func TestWriteTTMLOutline(t *testing.T) {
+	data, err := Encode(TTML, Track{Style: DefaultStyle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`tts:fontFamily="Arial" tts:fontSize="24px" tts:color="white" tts:textAlign="center" tts:textOutline="black 2px"/>`,
+		`tts:origin="10% 75%" tts:extent="80% 20%" tts:displayAlign="after"`,
+		"<tt xmlns=\"http://www.w3.org/ns/ttml\" xmlns:tts=\"http://www.w3.org/ns/ttml#styling\">\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("output does not contain %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		want Format
+	}{
+		{"srt", SRT},
+		{" VTT ", VTT},
+		{"WebVTT", VTT},
+		{"ssa", ASS},
+		{"dfxp", TTML},
+		{"sub", ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.name)
+		if got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := Encode("sub", Track{}); err == nil {
+		t.Error("Encode accepted an unsupported format")
+	}
+}
+
+func checkEncode(t *testing.T, format Format, track Track, want string) []byte {
+	t.Helper()
+
+	got, err := Encode(format, track)
+	if err != nil {
+		t.Fatalf("Encode(%s): %v", format, err)
+	}
+	if string(got) != want {
+		t.Errorf("Encode(%s) =\n%s\nwant\n%s", format, got, want)
+	}
+	return got
+}
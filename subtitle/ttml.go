@@ -0,0 +1,67 @@
+package subtitle
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ttmlRegions 位置对应的显示区域，origin 和 extent 均为画面的百分比
+var ttmlRegions = map[string]struct {
+	origin, extent, align string
+}{
+	PositionBottom: {"10% 75%", "80% 20%", "after"},
+	PositionMiddle: {"10% 40%", "80% 20%", "center"},
+	PositionTop:    {"10% 5%", "80% 20%", "before"},
+}
+
+// writeTTML 写出 TTML 字幕，时间格式为 00:00:01.500，样式和区域写在 head 中
+func writeTTML(w io.Writer, track Track) error {
+	style := track.Style
+	region, ok := ttmlRegions[style.Position]
+	if !ok {
+		region = ttmlRegions[PositionBottom]
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling"`)
+	if track.Language != "" {
+		fmt.Fprintf(bw, ` xml:lang="%s"`, escapeXML(track.Language))
+	}
+	bw.WriteString(">\n  <head>\n    <styling>\n")
+	fmt.Fprintf(bw, `      <style xml:id="default" tts:fontFamily="%s" tts:fontSize="%dpx" tts:color="white" tts:textAlign="center"`,
+		escapeXML(style.Font), style.FontSize)
+	if style.Outline > 0 {
+		fmt.Fprintf(bw, ` tts:textOutline="black %dpx"`, style.Outline)
+	}
+	bw.WriteString("/>\n    </styling>\n    <layout>\n")
+	fmt.Fprintf(bw, `      <region xml:id="subtitle" tts:origin="%s" tts:extent="%s" tts:displayAlign="%s"/>`+"\n",
+		region.origin, region.extent, region.align)
+	bw.WriteString("    </layout>\n  </head>\n  <body style=\"default\" region=\"subtitle\">\n    <div>\n")
+
+	for _, cue := range track.Cues {
+		text := lines(cue.Text)
+		for i := range text {
+			text[i] = escapeXML(text[i])
+		}
+		fmt.Fprintf(bw, `      <p begin="%s" end="%s">%s</p>`+"\n", ttmlTime(cue.Start), ttmlTime(cue.End), strings.Join(text, "<br/>"))
+	}
+
+	bw.WriteString("    </div>\n  </body>\n</tt>\n")
+	return bw.Flush()
+}
+
+func ttmlTime(d time.Duration) string {
+	h, m, s, ms := clock(d)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+}
+
+func escapeXML(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
@@ -0,0 +1,46 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// vttEscaper 转义 WebVTT 文本中有特殊含义的字符
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// writeVTT 写出 WebVTT 字幕，时间格式为 00:00:01.500。位置通过 cue 的 line 设置表达
+func writeVTT(w io.Writer, track Track) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+
+	settings := vttSettings(track.Style)
+	for i, cue := range track.Cues {
+		fmt.Fprintf(bw, "%d\n%s --> %s%s\n", i+1, vttTime(cue.Start), vttTime(cue.End), settings)
+		for _, line := range lines(cue.Text) {
+			bw.WriteString(vttEscaper.Replace(line))
+			bw.WriteString("\n")
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// vttSettings 底部是播放器的默认位置，不需要额外设置
+func vttSettings(style Style) string {
+	switch style.Position {
+	case PositionTop:
+		return " line:0 align:center"
+	case PositionMiddle:
+		return " line:50% align:center"
+	default:
+		return ""
+	}
+}
+
+func vttTime(d time.Duration) string {
+	h, m, s, ms := clock(d)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms)
+}
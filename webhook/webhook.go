@@ -0,0 +1,277 @@
+// Package webhook notifies callers when their tasks finish. Deliveries are
+// persisted first and sent by the worker, so a failed callback is retried
+// with exponential backoff instead of being lost.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"video-agent-go/config"
+	"video-agent-go/model"
+	"video-agent-go/netguard"
+)
+
+// 回调请求头。签名为 "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))，
+// 接收方应校验签名并拒绝时间戳过旧的请求以防重放
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// pollInterval 投递循环检查到期回调的间隔
+	pollInterval = 2 * time.Second
+	// claimBatch 每次最多领取的回调数
+	claimBatch = 20
+	// maxErrorBody 记录失败原因时最多保留的响应体长度
+	maxErrorBody = 512
+)
+
+// ErrNoSecret 没有配置签名密钥时不接受回调，接收方无法验证未签名的请求
+var ErrNoSecret = errors.New("callback_url is not supported: WEBHOOK_SECRET is not configured")
+
+// Sign 计算回调请求的签名
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateCallback 检查任务的回调地址，服务端必须配置了签名密钥
+func ValidateCallback(rawURL string) error {
+	if config.AppConfig.Webhook.Secret == "" {
+		return ErrNoSecret
+	}
+	return ValidateURL(rawURL)
+}
+
+// ValidateURL 检查回调地址是否为绝对的 http(s) 地址，且主机解析出的地址都是公网地址，
+// 避免通过回调访问回环、内网、链路本地和云厂商元数据等地址
+func ValidateURL(rawURL string) error {
+	if err := netguard.ValidateURL(rawURL); err != nil {
+		return fmt.Errorf("callback_url %w", err)
+	}
+	return nil
+}
+
+// newClient 回调使用的HTTP客户端：只连接公网地址，不使用代理，不跟随重定向
+func newClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: netguard.NewTransport(),
+		// 重定向可能指向内网地址，3xx 按投递失败处理
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// NotifyTaskFinished 任务完成或失败后，为配置了 callback_url 的任务记录一条待投递的回调
+func NotifyTaskFinished(taskID string) error {
+	task, err := model.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+
+	var input model.UserInput
+	if err := json.Unmarshal([]byte(task.Input), &input); err != nil {
+		return fmt.Errorf("invalid task input: %w", err)
+	}
+	if input.CallbackURL == "" {
+		return nil
+	}
+
+	payload := model.WebhookPayload{
+		TaskID:    task.TaskID,
+		Status:    task.Status,
+		Mode:      task.Mode,
+		Timestamp: time.Now(),
+	}
+	switch task.Status {
+	case model.TaskStateCompleted:
+		payload.Event = model.WebhookTaskCompleted
+		if task.Output != "" {
+			result := &model.ScriptOutput{}
+			if err := json.Unmarshal([]byte(task.Output), result); err == nil {
+				payload.Result = result
+			}
+		}
+	case model.TaskStateFailed:
+		payload.Event = model.WebhookTaskFailed
+		payload.Error = task.Error
+	default:
+		return fmt.Errorf("task %s is %s, nothing to notify", taskID, task.Status)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	id, err := model.CreateWebhookDelivery(taskID, payload.Event, input.CallbackURL, body, maxAttempts(config.AppConfig.Webhook))
+	if err != nil {
+		return fmt.Errorf("failed to record webhook for task %s: %w", taskID, err)
+	}
+	log.Printf("📮 Webhook %d (%s) queued for task %s", id, payload.Event, taskID)
+	return nil
+}
+
+// MaxAttempts 单条回调的最大投递次数，手动重新投递时也按此补充次数
+func MaxAttempts() int {
+	return maxAttempts(config.AppConfig.Webhook)
+}
+
+func maxAttempts(cfg config.WebhookConfig) int {
+	if cfg.MaxAttempts < 1 {
+		return 1
+	}
+	return cfg.MaxAttempts
+}
+
+// Dispatcher 定期领取到期的回调并发送，失败时按指数退避安排下次重试
+type Dispatcher struct {
+	Secret    string
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	client    *http.Client
+}
+
+// NewDispatcher 根据配置创建投递器
+func NewDispatcher(cfg config.WebhookConfig) *Dispatcher {
+	return &Dispatcher{
+		Secret:    cfg.Secret,
+		BaseDelay: cfg.RetryBaseDelay,
+		MaxDelay:  cfg.RetryMaxDelay,
+		client:    newClient(cfg.Timeout),
+	}
+}
+
+// Run 投递到期的回调直到ctx取消
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	// 领取时把下次尝试时间推后一个请求超时之外，投递进行中不会被其他worker重复领取
+	lease := d.client.Timeout + time.Minute
+	deliveries, err := model.ClaimDueWebhooks(claimBatch, lease)
+	if err != nil {
+		log.Printf("Failed to claim webhooks: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *model.WebhookDelivery) {
+			defer wg.Done()
+			d.deliver(ctx, delivery)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *model.WebhookDelivery) {
+	attempt := model.WebhookAttempt{DeliveryID: delivery.ID, Attempt: delivery.Attempts + 1}
+
+	start := time.Now()
+	attempt.StatusCode, attempt.Error = d.send(ctx, delivery)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if ctx.Err() != nil {
+		// worker正在退出，不计入尝试次数，租约到期后会重新投递
+		return
+	}
+
+	retryIn := d.backoff(attempt.Attempt)
+	if err := model.RecordWebhookAttempt(delivery, attempt, retryIn); err != nil {
+		log.Printf("Failed to record attempt %d of webhook %d: %v", attempt.Attempt, delivery.ID, err)
+		return
+	}
+
+	switch {
+	case attempt.Error == "":
+		log.Printf("📬 Webhook %d for task %s delivered", delivery.ID, delivery.TaskID)
+	case attempt.Attempt >= delivery.MaxAttempts:
+		log.Printf("❌ Webhook %d for task %s failed after %d attempts: %s", delivery.ID, delivery.TaskID, attempt.Attempt, attempt.Error)
+	default:
+		log.Printf("Webhook %d for task %s failed (attempt %d/%d), retrying in %v: %s",
+			delivery.ID, delivery.TaskID, attempt.Attempt, delivery.MaxAttempts, retryIn, attempt.Error)
+	}
+}
+
+// send 发送一次回调，返回响应状态码和错误描述，接收方返回2xx时错误为空。
+// 回调必须带签名，没有配置密钥时不发送
+func (d *Dispatcher) send(ctx context.Context, delivery *model.WebhookDelivery) (int, string) {
+	if d.Secret == "" {
+		return 0, ErrNoSecret.Error()
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "video-agent-webhook/1.0")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp.StatusCode, fmt.Sprintf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return resp.StatusCode, ""
+}
+
+// backoff 计算第attempt次失败后的等待时间，带抖动避免同时重试
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.BaseDelay << uint(attempt-1)
+	if d.MaxDelay > 0 && (delay > d.MaxDelay || delay <= 0) {
+		delay = d.MaxDelay
+	}
+	if delay <= 0 {
+		return time.Second
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"video-agent-go/config"
+	"video-agent-go/model"
+)
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://8.8.8.8/hooks/video", true},
+		{"http://1.1.1.1:8080/hook", true},
+		{"https://[2606:4700:4700::1111]/hook", true},
+		{"ftp://8.8.8.8/hook", false},
+		{"/hooks/video", false},
+		{"https:///hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://localhost:9000/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://10.1.2.3/hook", false},
+		{"http://172.16.0.5/hook", false},
+		{"http://192.168.1.10/hook", false},
+		{"http://100.64.0.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://[fe80::1]/hook", false},
+		{"http://[fd00:ec2::254]/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+		{"http://224.0.0.1/hook", false},
+	}
+	for _, tt := range tests {
+		err := ValidateURL(tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateURL(%q) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateCallbackRequiresSecret(t *testing.T) {
+	prev := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = prev })
+
+	config.AppConfig = &config.Config{}
+	if err := ValidateCallback("https://8.8.8.8/hook"); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("got %v without a secret, want ErrNoSecret", err)
+	}
+
+	config.AppConfig.Webhook.Secret = "s3cret"
+	if err := ValidateCallback("https://8.8.8.8/hook"); err != nil {
+		t.Errorf("got %v with a secret, want the URL accepted", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	if got := Sign("secret", 1700000000, []byte(`{"a":1}`)); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{Secret: "s3cret", client: srv.Client()}
+	status, errMsg := d.send(context.Background(), &model.WebhookDelivery{
+		ID: 7, URL: srv.URL, Event: model.WebhookTaskCompleted, Payload: `{"task_id":"t"}`,
+	})
+	if status != http.StatusOK || errMsg != "" {
+		t.Fatalf("got %d %q, want delivered", status, errMsg)
+	}
+
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header %q", header.Get(TimestampHeader))
+	}
+	if got, want := header.Get(SignatureHeader), Sign("s3cret", timestamp, body); got != want {
+		t.Errorf("got signature %q, want %q", got, want)
+	}
+	if header.Get(EventHeader) != string(model.WebhookTaskCompleted) || header.Get(DeliveryHeader) != "7" {
+		t.Errorf("got event %q delivery %q", header.Get(EventHeader), header.Get(DeliveryHeader))
+	}
+}
+
+func TestSendRefusesUnsigned(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{client: srv.Client()}
+	if _, errMsg := d.send(context.Background(), &model.WebhookDelivery{URL: srv.URL, Payload: "{}"}); errMsg == "" {
+		t.Error("unsigned callback was sent")
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Error("unsigned callback reached the receiver")
+	}
+}
+
+func TestSendDoesNotFollowRedirects(t *testing.T) {
+	var redirected int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			atomic.AddInt32(&redirected, 1)
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	// The real client refuses loopback addresses, so reuse its redirect policy only
+	client := srv.Client()
+	client.CheckRedirect = newClient(time.Second).CheckRedirect
+
+	d := &Dispatcher{Secret: "s3cret", client: client}
+	status, errMsg := d.send(context.Background(), &model.WebhookDelivery{URL: srv.URL + "/hook", Payload: "{}"})
+	if status != http.StatusTemporaryRedirect || errMsg == "" {
+		t.Errorf("got %d %q, want the redirect reported as a failure", status, errMsg)
+	}
+	if atomic.LoadInt32(&redirected) != 0 {
+		t.Error("redirect was followed")
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(config.WebhookConfig{Secret: "s3cret", Timeout: time.Second})
+	if _, errMsg := d.send(context.Background(), &model.WebhookDelivery{URL: srv.URL, Payload: "{}"}); !strings.Contains(errMsg, "non-public") {
+		t.Errorf("got %q, want the loopback address refused", errMsg)
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Error("callback reached a loopback address")
+	}
+}
@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"log"
+
+	"video-agent-go/model"
+)
+
+// taskCheckpointer 把各阶段产物记录到 task_checkpoints，写入失败只记日志，不影响当前执行
+type taskCheckpointer struct {
+	taskID string
+}
+
+func (c taskCheckpointer) SaveScript(script *model.ScriptOutput) {
+	if err := store.SaveScriptCheckpoint(c.taskID, script); err != nil {
+		log.Printf("Failed to checkpoint script for task %s: %v", c.taskID, err)
+	}
+}
+
+func (c taskCheckpointer) SaveShotImage(shot int, path string) {
+	c.save(model.CheckpointImage, shot, path)
+}
+
+func (c taskCheckpointer) SaveShotVoice(shot int, path string) {
+	c.save(model.CheckpointVoice, shot, path)
+}
+
+func (c taskCheckpointer) SaveShotClip(shot int, path string) {
+	c.save(model.CheckpointClip, shot, path)
+}
+
+func (c taskCheckpointer) save(kind model.CheckpointKind, shot int, value string) {
+	if err := store.SaveCheckpoint(c.taskID, kind, shot, value); err != nil {
+		log.Printf("Failed to checkpoint %s of shot %d for task %s: %v", kind, shot, c.taskID, err)
+	}
+}
+
+// loadResume 读取上次失败前保存的脚本和素材，读取失败时从头开始
+func loadResume(taskID string) *model.ScriptOutput {
+	script, err := store.LoadResumeScript(taskID)
+	if err != nil {
+		log.Printf("Failed to load checkpoints for task %s, starting over: %v", taskID, err)
+		return nil
+	}
+	return script
+}
@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"video-agent-go/agent"
+	"video-agent-go/model"
+)
+
+// workDirSweepInterval 检查本机任务工作目录的间隔
+const workDirSweepInterval = time.Hour
+
+// removeWorkDir 删除任务的工作目录，失败只记日志
+func removeWorkDir(taskID string) {
+	if err := os.RemoveAll(agent.TaskWorkDir(taskID)); err != nil {
+		log.Printf("Failed to clean up work dir of task %s: %v", taskID, err)
+	}
+}
+
+// sweepWorkDirs 定期删除本机上不再需要的任务工作目录：任务已完成或已取消，
+// 或者失败后超过保留期仍未重试
+func (p *Pool) sweepWorkDirs(ctx context.Context) {
+	for {
+		p.sweepWorkDirsOnce(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(workDirSweepInterval):
+		}
+	}
+}
+
+func (p *Pool) sweepWorkDirsOnce(now time.Time) {
+	entries, err := os.ReadDir(agent.TaskWorkRoot)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to list task work dirs: %v", err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		taskID := entry.Name()
+		task, err := model.GetTask(taskID)
+		if errors.Is(err, sql.ErrNoRows) {
+			task, err = nil, nil
+		}
+		if err != nil {
+			log.Printf("Failed to check task %s for work dir cleanup: %v", taskID, err)
+			continue
+		}
+		if workDirExpired(task, p.FailedRetention, now) {
+			log.Printf("🧹 Removing work dir of task %s", taskID)
+			removeWorkDir(taskID)
+		}
+	}
+}
+
+// workDirExpired 任务不存在、已完成或已取消时不再需要工作目录，
+// 失败的任务在保留期内等待重试，其余任务仍在排队或执行
+func workDirExpired(task *model.VideoTask, retention time.Duration, now time.Time) bool {
+	if task == nil {
+		return true
+	}
+	switch task.Status {
+	case model.TaskStateCompleted, model.TaskStateCancelled:
+		return true
+	case model.TaskStateFailed:
+		return now.Sub(task.UpdatedAt) > retention
+	default:
+		return false
+	}
+}
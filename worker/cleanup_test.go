@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"video-agent-go/model"
+)
+
+func TestWorkDirExpired(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	retention := 72 * time.Hour
+
+	tests := []struct {
+		name string
+		task *model.VideoTask
+		want bool
+	}{
+		{"missing task", nil, true},
+		{"completed", &model.VideoTask{Status: model.TaskStateCompleted, UpdatedAt: now}, true},
+		{"cancelled", &model.VideoTask{Status: model.TaskStateCancelled, UpdatedAt: now}, true},
+		{"recently failed", &model.VideoTask{Status: model.TaskStateFailed, UpdatedAt: now.Add(-time.Hour)}, false},
+		{"failed long ago", &model.VideoTask{Status: model.TaskStateFailed, UpdatedAt: now.Add(-4 * 24 * time.Hour)}, true},
+		{"pending retry", &model.VideoTask{Status: model.TaskStatePending, UpdatedAt: now.Add(-4 * 24 * time.Hour)}, false},
+		{"processing", &model.VideoTask{Status: model.TaskStateProcessing, UpdatedAt: now.Add(-4 * 24 * time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := workDirExpired(tt.task, retention, now); got != tt.want {
+				t.Errorf("workDirExpired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"video-agent-go/agent"
+	"video-agent-go/model"
+)
+
+// 🔧 新的Tool-based处理流程
+func processVideoWithTools(ctx context.Context, taskID string, input model.UserInput) error {
+	log.Printf("🔧 Starting tool-based video processing for task: %s", taskID)
+
+	// 创建Tool-based编排器，重试时从检查点继续
+	orchestrator := agent.NewToolBasedOrchestrator()
+	orchestrator.Checkpoints = taskCheckpointer{taskID: taskID}
+	orchestrator.Resume = loadResume(taskID)
+	orchestrator.Recorder = executionRecorder{}
+	orchestrator.ReferenceImages = input.Images
+	orchestrator.SourceVideo = input.Video
+	orchestrator.UserAudio = input.Audio
+	orchestrator.AudioRole = input.AudioUsage()
+	orchestrator.SubtitleFormats = input.SubtitleFormats
+
+	// 注册任务观察者
+	if err := startTask(taskID); err != nil {
+		return err
+	}
+	reportProgress(taskID, "tool_orchestration", 5, "Initializing tool-based orchestrator")
+
+	// 🎯 LLM + Tools 驱动的智能处理
+	result, err := orchestrator.ProcessTask(ctx, taskID, input.Text)
+	if err != nil {
+		log.Printf("❌ Tool-based orchestration failed for task %s: %v", taskID, err)
+		failTask(ctx, taskID, "tool_orchestration", err)
+		return err
+	}
+
+	// 更新任务结果
+	if err := completeTask(taskID, result, "Video generated successfully using LLM + Tools orchestration"); err != nil {
+		return err
+	}
+	log.Printf("✅ Tool-based video processing completed for task: %s", taskID)
+	return nil
+}
+
+// 🚀 新的智能处理流程 - LLM驱动
+func processVideoSmart(ctx context.Context, taskID string, input model.UserInput) error {
+	log.Printf("🧠 Starting LLM-driven video processing for task: %s", taskID)
+
+	// 创建智能编排器，重试时从检查点继续
+	orchestrator := agent.NewOrchestrator()
+	orchestrator.Checkpoints = taskCheckpointer{taskID: taskID}
+	orchestrator.Resume = loadResume(taskID)
+	orchestrator.Recorder = executionRecorder{}
+
+	// 注册任务观察者
+	if err := startTask(taskID); err != nil {
+		return err
+	}
+	reportProgress(taskID, "agent_orchestration", 5, "Initializing LLM orchestrator")
+
+	// 🎯 LLM 驱动的智能处理
+	result, err := orchestrator.ProcessTask(ctx, taskID, input)
+	if err != nil {
+		log.Printf("❌ LLM orchestration failed for task %s: %v", taskID, err)
+		failTask(ctx, taskID, "agent_orchestration", err)
+		return err
+	}
+
+	// 更新任务结果
+	if err := completeTask(taskID, result, "Video generated successfully using LLM orchestration"); err != nil {
+		return err
+	}
+	log.Printf("✅ LLM-driven video processing completed for task: %s", taskID)
+	return nil
+}
+
+// 保留原有的固定流程处理函数。每个阶段的产物都会记录检查点，
+// 重试时只重新生成缺失或失败的部分
+func processVideo(ctx context.Context, taskID string, input model.UserInput) error {
+	log.Printf("Processing video task: %s", taskID)
+
+	if err := startTask(taskID); err != nil {
+		return err
+	}
+	checkpoints := taskCheckpointer{taskID: taskID}
+
+	// Step 1: Generate script
+	script := loadResume(taskID)
+	if script != nil {
+		log.Printf("♻️ Reusing checkpointed script for task %s", taskID)
+	} else {
+		reportProgress(taskID, "script", 5, "Generating script")
+		generated, err := agent.GenerateScript(ctx, input)
+		if err != nil {
+			log.Printf("Failed to generate script: %v", err)
+			failTask(ctx, taskID, "script", err)
+			return err
+		}
+		script = generated
+		checkpoints.SaveScript(script)
+	}
+
+	// Step 2: Process each shot, skipping assets that already exist
+	var failures []string
+	for i := range script.Shots {
+		shot := &script.Shots[i]
+		reportProgress(taskID, "assets", 10+70*i/len(script.Shots), fmt.Sprintf("Generating assets for shot %d/%d", i+1, len(script.Shots)))
+
+		// Use the user's image when the script references one, otherwise generate it
+		if shot.ClipPath == "" {
+			imagePath, err := agent.ReferenceImage(ctx, *shot, input.Images)
+			if err == nil && imagePath == "" {
+				imagePath, err = agent.GenerateImage(ctx, shot.ImagePrompt)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("Failed to generate image: %v", err)
+				failures = append(failures, fmt.Sprintf("shot %d image: %v", i, err))
+			} else {
+				shot.ClipPath = imagePath
+				shot.RenderedClip = ""
+				checkpoints.SaveShotImage(i, imagePath)
+			}
+		}
+
+		// Generate voiceover, unless the user provided the narration
+		if shot.VoicePath == "" && shot.Voiceover != "" && script.Narration == "" {
+			voicePath, err := agent.GenerateVoiceover(ctx, shot.Voiceover)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("Failed to generate voiceover: %v", err)
+				failures = append(failures, fmt.Sprintf("shot %d voice: %v", i, err))
+			} else {
+				shot.VoicePath = voicePath
+				shot.RenderedClip = ""
+				checkpoints.SaveShotVoice(i, voicePath)
+			}
+		}
+	}
+
+	// 有镜头缺少素材时失败，已生成的素材保留在检查点中，重试时只补齐缺失的部分
+	if len(failures) > 0 {
+		err := fmt.Errorf("%d asset generations failed: %s", len(failures), strings.Join(failures, "; "))
+		failTask(ctx, taskID, "assets", err)
+		return err
+	}
+
+	// Step 3: Render final video
+	reportProgress(taskID, "render", 80, "Rendering video")
+	finalPath, err := agent.RenderVideoWithOptions(ctx, script, agent.RenderOptions{
+		WorkDir: agent.TaskWorkDir(taskID),
+		OnClip:  checkpoints.SaveShotClip,
+	})
+	if err != nil {
+		log.Printf("Failed to render video: %v", err)
+		failTask(ctx, taskID, "render", err)
+		return err
+	}
+
+	script.Final = finalPath
+	script.TaskID = taskID
+	script.Status = string(model.TaskStateCompleted)
+
+	// Update task with result
+	if err := completeTask(taskID, script, "Video generated successfully"); err != nil {
+		return err
+	}
+	log.Printf("Video task completed: %s", taskID)
+	return nil
+}
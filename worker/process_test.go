@@ -0,0 +1,242 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"video-agent-go/agent"
+	"video-agent-go/config"
+	"video-agent-go/internal/fakeopenai"
+	"video-agent-go/model"
+)
+
+// memStore keeps task state in memory so the pipeline tests don't need MySQL.
+type memStore struct {
+	mu          sync.Mutex
+	tasks       map[string]*model.VideoTask
+	checkpoints map[string][]model.CheckpointKind
+	records     map[string]int
+	notified    map[string]int
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		tasks:       make(map[string]*model.VideoTask),
+		checkpoints: make(map[string][]model.CheckpointKind),
+		records:     make(map[string]int),
+		notified:    make(map[string]int),
+	}
+}
+
+func (s *memStore) createTask(taskID string, mode model.TaskMode, input string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tasks[taskID] = &model.VideoTask{TaskID: taskID, Mode: mode, Input: input, Status: model.TaskStatePending}
+}
+
+func (s *memStore) task(taskID string) model.VideoTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return *s.tasks[taskID]
+}
+
+func (s *memStore) TransitionTask(taskID string, to model.TaskState, stage string, progress int, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if task.Status == to {
+		return nil
+	}
+	if !task.Status.CanTransitionTo(to) {
+		return &model.TransitionError{TaskID: taskID, From: task.Status, To: to}
+	}
+	task.Status, task.Stage, task.Progress, task.Error = to, stage, progress, errMsg
+	return nil
+}
+
+func (s *memStore) UpdateTaskProgress(taskID, stage string, progress int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if task, ok := s.tasks[taskID]; ok && task.Status == model.TaskStateProcessing {
+		task.Stage, task.Progress = stage, progress
+	}
+	return nil
+}
+
+func (s *memStore) CompleteTask(taskID string, output interface{}) error {
+	data, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+	if err := s.TransitionTask(taskID, model.TaskStateCompleted, "done", 100, ""); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[taskID].Output = string(data)
+	return nil
+}
+
+func (s *memStore) FailTask(taskID, stage string, cause error) error {
+	return s.TransitionTask(taskID, model.TaskStateFailed, stage, s.task(taskID).Progress, cause.Error())
+}
+
+func (s *memStore) SaveCheckpoint(taskID string, kind model.CheckpointKind, shotIndex int, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[taskID] = append(s.checkpoints[taskID], kind)
+	return nil
+}
+
+func (s *memStore) SaveScriptCheckpoint(taskID string, script *model.ScriptOutput) error {
+	return s.SaveCheckpoint(taskID, model.CheckpointScript, -1, "")
+}
+
+// LoadResumeScript finds nothing to resume: the tests only run new tasks.
+func (s *memStore) LoadResumeScript(taskID string) (*model.ScriptOutput, error) {
+	return nil, nil
+}
+
+func (s *memStore) SaveExecutionRecord(record *model.ExecutionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.TaskID]++
+	return nil
+}
+
+func (s *memStore) NotifyTaskFinished(taskID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.notified[taskID]++
+	return nil
+}
+
+// The pipeline tests run every processing mode end to end against the fake
+// OpenAI server, with task state kept in a memStore. Rendering needs ffmpeg
+// and ffprobe on PATH.
+func setupPipeline(t *testing.T) *memStore {
+	t.Helper()
+
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+
+	mem := newMemStore()
+	prevStore := store
+	store = mem
+	t.Cleanup(func() { store = prevStore })
+
+	srv := fakeopenai.New()
+	t.Cleanup(srv.Close)
+	prevConfig := config.AppConfig
+	config.AppConfig = srv.Config()
+	agent.SetLLMProvider(nil)
+	t.Cleanup(func() {
+		config.AppConfig = prevConfig
+		agent.SetLLMProvider(nil)
+	})
+
+	// Generated files go under ./uploads and ./temp
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return mem
+}
+
+// runPipeline creates a task in the given mode, processes it like the worker
+// would and returns the stored result.
+func runPipeline(t *testing.T, mem *memStore, mode model.TaskMode, process Handler) *model.ScriptOutput {
+	t.Helper()
+
+	input := model.UserInput{Text: "A day in the city", Style: "documentary"}
+	data, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskID := fmt.Sprintf("test-%s-%d", mode, time.Now().UnixNano())
+	mem.createTask(taskID, mode, string(data))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := process(ctx, taskID, input); err != nil {
+		t.Fatalf("processing %s task: %v", mode, err)
+	}
+
+	task := mem.task(taskID)
+	if task.Status != model.TaskStateCompleted || task.Progress != 100 {
+		t.Fatalf("task is %s at %d%%, want completed at 100%%", task.Status, task.Progress)
+	}
+	if mem.notified[taskID] != 1 {
+		t.Errorf("completion was notified %d times, want once", mem.notified[taskID])
+	}
+	if !containsKind(mem.checkpoints[taskID], model.CheckpointScript) {
+		t.Errorf("no script checkpoint among %v", mem.checkpoints[taskID])
+	}
+	if _, err := os.Stat(agent.TaskWorkDir(taskID)); !os.IsNotExist(err) {
+		t.Errorf("work dir of the completed task was not removed: %v", err)
+	}
+
+	var result model.ScriptOutput
+	if err := json.Unmarshal([]byte(task.Output), &result); err != nil {
+		t.Fatalf("invalid task output %q: %v", task.Output, err)
+	}
+	if result.Final == "" {
+		t.Fatalf("task output has no final video: %s", task.Output)
+	}
+	if info, err := os.Stat(result.Final); err != nil || info.Size() == 0 {
+		t.Fatalf("final video %s was not written: %v", result.Final, err)
+	}
+	if len(result.Shots) != 2 {
+		t.Errorf("got %d shots, want the 2 of the default script", len(result.Shots))
+	}
+	return &result
+}
+
+func containsKind(kinds []model.CheckpointKind, kind model.CheckpointKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProcessVideo(t *testing.T) {
+	mem := setupPipeline(t)
+	runPipeline(t, mem, model.TaskModeFixed, processVideo)
+}
+
+func TestProcessVideoSmart(t *testing.T) {
+	mem := setupPipeline(t)
+	runPipeline(t, mem, model.TaskModeSmart, processVideoSmart)
+}
+
+func TestProcessVideoWithTools(t *testing.T) {
+	mem := setupPipeline(t)
+	runPipeline(t, mem, model.TaskModeTools, processVideoWithTools)
+}
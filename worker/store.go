@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"video-agent-go/model"
+	"video-agent-go/webhook"
+)
+
+// TaskStore 任务处理过程中读写的持久化状态：任务状态、检查点、执行记录和完成通知。
+// 默认保存在 MySQL，测试中替换为内存实现
+type TaskStore interface {
+	TransitionTask(taskID string, to model.TaskState, stage string, progress int, errMsg string) error
+	UpdateTaskProgress(taskID, stage string, progress int) error
+	CompleteTask(taskID string, output interface{}) error
+	FailTask(taskID, stage string, cause error) error
+
+	SaveCheckpoint(taskID string, kind model.CheckpointKind, shotIndex int, value string) error
+	SaveScriptCheckpoint(taskID string, script *model.ScriptOutput) error
+	LoadResumeScript(taskID string) (*model.ScriptOutput, error)
+
+	SaveExecutionRecord(record *model.ExecutionRecord) error
+	NotifyTaskFinished(taskID string) error
+}
+
+// store 处理函数使用的任务存储
+var store TaskStore = mysqlStore{}
+
+// mysqlStore 把任务状态保存在 video_tasks 等表中，完成通知写入 webhook 投递队列
+type mysqlStore struct{}
+
+func (mysqlStore) TransitionTask(taskID string, to model.TaskState, stage string, progress int, errMsg string) error {
+	return model.TransitionTask(taskID, to, stage, progress, errMsg)
+}
+
+func (mysqlStore) UpdateTaskProgress(taskID, stage string, progress int) error {
+	return model.UpdateTaskProgress(taskID, stage, progress)
+}
+
+func (mysqlStore) CompleteTask(taskID string, output interface{}) error {
+	return model.CompleteTask(taskID, output)
+}
+
+func (mysqlStore) FailTask(taskID, stage string, cause error) error {
+	return model.FailTask(taskID, stage, cause)
+}
+
+func (mysqlStore) SaveCheckpoint(taskID string, kind model.CheckpointKind, shotIndex int, value string) error {
+	return model.SaveCheckpoint(taskID, kind, shotIndex, value)
+}
+
+func (mysqlStore) SaveScriptCheckpoint(taskID string, script *model.ScriptOutput) error {
+	return model.SaveScriptCheckpoint(taskID, script)
+}
+
+func (mysqlStore) LoadResumeScript(taskID string) (*model.ScriptOutput, error) {
+	return model.LoadResumeScript(taskID)
+}
+
+func (mysqlStore) SaveExecutionRecord(record *model.ExecutionRecord) error {
+	return model.SaveExecutionRecord(record)
+}
+
+func (mysqlStore) NotifyTaskFinished(taskID string) error {
+	return webhook.NotifyTaskFinished(taskID)
+}
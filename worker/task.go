@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"video-agent-go/agent"
+	"video-agent-go/model"
+)
+
+// startTask 把任务从 pending 迁移到 processing；重新入队的作业再次领取时任务已是 processing，同样允许继续
+func startTask(taskID string) error {
+	agent.GetObserverManager().RegisterTask(taskID)
+
+	if err := store.TransitionTask(taskID, model.TaskStateProcessing, "starting", 0, ""); err != nil {
+		return fmt.Errorf("task %s cannot start: %w", taskID, err)
+	}
+
+	agent.GetObserverManager().UpdateTask(taskID, agent.TaskProcessing, 0, "Task started")
+	return nil
+}
+
+// reportProgress 同时更新内存观察者和数据库中的进度
+func reportProgress(taskID, stage string, progress int, message string) {
+	agent.GetObserverManager().UpdateTask(taskID, agent.TaskProcessing, progress, message)
+
+	if err := store.UpdateTaskProgress(taskID, stage, progress); err != nil {
+		log.Printf("Failed to persist progress for task %s: %v", taskID, err)
+	}
+}
+
+// completeTask 保存结果并把任务标记为完成，之后不再需要保留用于重试的片段
+func completeTask(taskID string, result interface{}, message string) error {
+	if err := store.CompleteTask(taskID, result); err != nil {
+		return fmt.Errorf("failed to complete task %s: %w", taskID, err)
+	}
+	removeWorkDir(taskID)
+
+	agent.GetObserverManager().UpdateTask(taskID, agent.TaskCompleted, 100, message)
+	notify(taskID)
+	return nil
+}
+
+// failTask 记录错误并把任务标记为失败。ctx已取消说明任务被用户取消或作业已被其他worker接管，
+// 此时不覆盖任务状态
+func failTask(ctx context.Context, taskID, stage string, cause error) {
+	if ctx.Err() != nil {
+		log.Printf("Task %s stopped at %s: %v", taskID, stage, cause)
+		return
+	}
+
+	if err := store.FailTask(taskID, stage, cause); err != nil {
+		log.Printf("Failed to mark task %s as failed: %v", taskID, err)
+		return
+	}
+
+	agent.GetObserverManager().UpdateTask(taskID, agent.TaskFailed, 0, fmt.Sprintf("Processing failed: %v", cause))
+	notify(taskID)
+}
+
+// notify 为设置了回调地址的任务安排完成/失败通知
+func notify(taskID string) {
+	if err := store.NotifyTaskFinished(taskID); err != nil {
+		log.Printf("Failed to queue webhook for task %s: %v", taskID, err)
+	}
+}
+
+// PersistEvent 把本进程发布的任务事件写入数据库，API 进程从数据库读取后推送给订阅者
+func PersistEvent(event model.TaskEvent) {
+	if err := model.SaveTaskEvent(&event); err != nil {
+		log.Printf("Failed to persist %s event for task %s: %v", event.Type, event.TaskID, err)
+	}
+}
+
+// executionRecorder 把智能体步骤和工具调用写入 task_executions，写入失败只记日志
+type executionRecorder struct{}
+
+func (executionRecorder) RecordExecution(record model.ExecutionRecord) {
+	if err := store.SaveExecutionRecord(&record); err != nil {
+		log.Printf("Failed to record %s %s for task %s: %v", record.Kind, record.Name, record.TaskID, err)
+	}
+}
@@ -0,0 +1,248 @@
+// Package worker leases queued video jobs from the database and runs them.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"video-agent-go/agent"
+	"video-agent-go/config"
+	"video-agent-go/model"
+)
+
+// Handler 处理一种作业类型，任务被取消或租约丢失时ctx会被取消
+type Handler func(ctx context.Context, taskID string, input model.UserInput) error
+
+// Pool 从作业队列领取作业并发执行，执行期间定时续租
+type Pool struct {
+	ID                string
+	Concurrency       int
+	LeaseDuration     time.Duration
+	HeartbeatInterval time.Duration
+	PollInterval      time.Duration
+	FailedRetention   time.Duration // 失败任务的工作目录保留多久等待重试
+	handlers          map[model.TaskMode]Handler
+}
+
+// NewPool 根据配置创建worker池，三种处理模式各对应一种作业类型
+func NewPool(cfg config.WorkerConfig) *Pool {
+	p := &Pool{
+		ID:                defaultWorkerID(),
+		Concurrency:       cfg.Concurrency,
+		LeaseDuration:     cfg.LeaseDuration,
+		HeartbeatInterval: cfg.HeartbeatInterval,
+		PollInterval:      cfg.PollInterval,
+		FailedRetention:   cfg.FailedRetention,
+		handlers: map[model.TaskMode]Handler{
+			model.TaskModeFixed: processVideo,
+			model.TaskModeSmart: processVideoSmart,
+			model.TaskModeTools: processVideoWithTools,
+		},
+	}
+	if p.Concurrency < 1 {
+		p.Concurrency = 1
+	}
+	if p.HeartbeatInterval <= 0 || p.HeartbeatInterval >= p.LeaseDuration {
+		p.HeartbeatInterval = p.LeaseDuration / 3
+	}
+	if p.PollInterval <= 0 {
+		p.PollInterval = time.Second
+	}
+	return p
+}
+
+// Run 启动Concurrency个执行循环、一个过期租约回收循环和一个工作目录清理循环，
+// ctx取消后停止领取新作业，并等待正在执行的作业结束
+func (p *Pool) Run(ctx context.Context) {
+	log.Printf("👷 Worker %s started with %d slots (lease %v, heartbeat %v)",
+		p.ID, p.Concurrency, p.LeaseDuration, p.HeartbeatInterval)
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.loop(ctx)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.reap(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.sweepWorkDirs(ctx)
+	}()
+
+	wg.Wait()
+	log.Printf("👷 Worker %s stopped", p.ID)
+}
+
+func (p *Pool) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := model.LeaseJob(p.ID, p.LeaseDuration)
+		if err != nil {
+			log.Printf("Failed to lease job: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(p.PollInterval):
+			}
+			continue
+		}
+
+		p.runJob(job)
+	}
+}
+
+// runJob 执行一个已租用的作业，执行期间后台续租并监听取消。
+// 作业使用独立的ctx，worker退出时不会中断正在执行的作业
+func (p *Pool) runJob(job *model.Job) {
+	log.Printf("▶️ Job %d (%s) for task %s, attempt %d/%d", job.ID, job.JobType, job.TaskID, job.Attempts, job.MaxAttempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var supervisor sync.WaitGroup
+	var taskCancelled bool
+	supervisor.Add(1)
+	go func() {
+		defer supervisor.Done()
+		taskCancelled = p.supervise(ctx, cancel, job)
+	}()
+
+	err := p.dispatch(ctx, job)
+	cancel()
+	supervisor.Wait()
+	agent.GetObserverManager().RemoveTask(job.TaskID)
+
+	// 取消的任务不会再执行，handler返回后即可删除它的工作目录
+	if taskCancelled {
+		removeWorkDir(job.TaskID)
+	}
+
+	if err != nil {
+		log.Printf("❌ Job %d for task %s failed: %v", job.ID, job.TaskID, err)
+		if err := model.FailJob(job.ID, p.ID, err); err != nil {
+			log.Printf("Failed to mark job %d as failed: %v", job.ID, err)
+		}
+		return
+	}
+
+	if err := model.CompleteJob(job.ID, p.ID); err != nil {
+		log.Printf("Failed to mark job %d as done: %v", job.ID, err)
+		return
+	}
+	log.Printf("✅ Job %d for task %s done", job.ID, job.TaskID)
+}
+
+func (p *Pool) dispatch(ctx context.Context, job *model.Job) error {
+	handler, ok := p.handlers[job.JobType]
+	if !ok {
+		err := fmt.Errorf("unknown job type %q", job.JobType)
+		failTask(ctx, job.TaskID, "dispatch", err)
+		return err
+	}
+
+	task, err := model.GetTask(job.TaskID)
+	if err != nil {
+		return fmt.Errorf("failed to load task %s: %w", job.TaskID, err)
+	}
+	if task.Status.IsTerminal() {
+		log.Printf("Task %s is already %s, skipping job %d", job.TaskID, task.Status, job.ID)
+		return nil
+	}
+
+	var input model.UserInput
+	if err := json.Unmarshal([]byte(task.Input), &input); err != nil {
+		err = fmt.Errorf("invalid task input: %w", err)
+		failTask(ctx, job.TaskID, "dispatch", err)
+		return err
+	}
+	if err := model.ResolveAssets(&input); err != nil {
+		err = fmt.Errorf("failed to resolve assets: %w", err)
+		failTask(ctx, job.TaskID, "dispatch", err)
+		return err
+	}
+
+	return handler(ctx, job.TaskID, input)
+}
+
+// supervise 定时续租，并在任务被取消或租约丢失时取消作业的ctx，任务被取消时返回true
+func (p *Pool) supervise(ctx context.Context, cancel context.CancelFunc, job *model.Job) bool {
+	heartbeat := time.NewTicker(p.HeartbeatInterval)
+	defer heartbeat.Stop()
+	cancelCheck := time.NewTicker(p.PollInterval)
+	defer cancelCheck.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-heartbeat.C:
+			err := model.HeartbeatJob(job.ID, p.ID, p.LeaseDuration)
+			if errors.Is(err, model.ErrLeaseLost) {
+				log.Printf("⚠️ Lost lease on job %d for task %s, stopping it", job.ID, job.TaskID)
+				cancel()
+				return false
+			}
+			if err != nil {
+				log.Printf("Heartbeat for job %d failed: %v", job.ID, err)
+			}
+		case <-cancelCheck.C:
+			task, err := model.GetTask(job.TaskID)
+			if err != nil {
+				log.Printf("Failed to check task %s for cancellation: %v", job.TaskID, err)
+				continue
+			}
+			if task.Status == model.TaskStateCancelled {
+				log.Printf("🛑 Task %s was cancelled, stopping job %d", job.TaskID, job.ID)
+				cancel()
+				return true
+			}
+		}
+	}
+}
+
+// reap 定期把租约过期的作业重新入队，重试次数用尽的任务标记为失败
+func (p *Pool) reap(ctx context.Context) {
+	ticker := time.NewTicker(p.LeaseDuration / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		requeued, abandoned, err := model.ReapExpiredJobs()
+		if err != nil {
+			log.Printf("Failed to reap expired jobs: %v", err)
+			continue
+		}
+		if requeued > 0 {
+			log.Printf("♻️ Re-queued %d jobs with expired leases", requeued)
+		}
+		for _, taskID := range abandoned {
+			failTask(context.Background(), taskID, "queue", errors.New("job lease expired too many times"))
+		}
+	}
+}
+
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}